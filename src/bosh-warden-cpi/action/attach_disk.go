@@ -9,12 +9,13 @@ import (
 )
 
 type AttachDiskMethod struct {
-	vmFinder   bwcvm.Finder
-	diskFinder bwcdisk.Finder
+	vmFinder    bwcvm.Finder
+	diskFinder  bwcdisk.Finder
+	diskChecker bwcdisk.Checker
 }
 
-func NewAttachDiskMethod(vmFinder bwcvm.Finder, diskFinder bwcdisk.Finder) AttachDiskMethod {
-	return AttachDiskMethod{vmFinder, diskFinder}
+func NewAttachDiskMethod(vmFinder bwcvm.Finder, diskFinder bwcdisk.Finder, diskChecker bwcdisk.Checker) AttachDiskMethod {
+	return AttachDiskMethod{vmFinder, diskFinder, diskChecker}
 }
 
 func (a AttachDiskMethod) AttachDisk(vmCID apiv1.VMCID, diskCID apiv1.DiskCID) error {
@@ -37,6 +38,11 @@ func (a AttachDiskMethod) AttachDiskV2(vmCID apiv1.VMCID, diskCID apiv1.DiskCID)
 		return apiv1.DiskHint{}, bosherr.WrapErrorf(err, "Finding disk '%s'", diskCID)
 	}
 
+	err = a.diskChecker.Check(disk)
+	if err != nil {
+		return apiv1.DiskHint{}, bosherr.WrapErrorf(err, "Checking disk '%s'", diskCID)
+	}
+
 	hint, err := vm.AttachDisk(disk)
 	if err != nil {
 		return apiv1.DiskHint{}, bosherr.WrapErrorf(err, "Attaching disk '%s' to VM '%s'", diskCID, vmCID)
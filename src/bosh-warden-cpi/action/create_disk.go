@@ -15,8 +15,20 @@ func NewCreateDiskMethod(diskCreator bwcdisk.Creator) CreateDiskMethod {
 	return CreateDiskMethod{diskCreator: diskCreator}
 }
 
-func (a CreateDiskMethod) CreateDisk(size int, _ apiv1.DiskCloudProps, _ *apiv1.VMCID) (apiv1.DiskCID, error) {
-	disk, err := a.diskCreator.Create(size)
+func (a CreateDiskMethod) CreateDisk(size int, cloudProps apiv1.DiskCloudProps, _ *apiv1.VMCID) (apiv1.DiskCID, error) {
+	var customCloudProps DiskCloudProperties
+
+	err := cloudProps.As(&customCloudProps)
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapError(err, "Parsing disk cloud properties")
+	}
+
+	diskProps, err := customCloudProps.AsDiskProps()
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapError(err, "Validating disk cloud properties")
+	}
+
+	disk, err := a.diskCreator.Create(size, diskProps)
 	if err != nil {
 		return apiv1.DiskCID{}, bosherr.WrapErrorf(err, "Creating disk of size '%d'", size)
 	}
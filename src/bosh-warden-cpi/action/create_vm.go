@@ -52,7 +52,7 @@ func (a CreateVMMethod) CreateVMV2(
 
 	vmProps, err := customCloudProps.AsVMProps()
 	if err != nil {
-		return apiv1.VMCID{}, networks, bosherr.WrapErrorf(err, "Validating 'ports' configuration")
+		return apiv1.VMCID{}, networks, bosherr.WrapErrorf(err, "Validating VM cloud properties")
 	}
 
 	vm, err := a.vmCreator.Create(agentID, stemcell, vmProps, networks, env)
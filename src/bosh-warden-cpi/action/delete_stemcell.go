@@ -1,18 +1,25 @@
 package action
 
 import (
+	"strings"
+
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 
 	bwcstem "bosh-warden-cpi/stemcell"
+	bwcvm "bosh-warden-cpi/vm"
 )
 
 type DeleteStemcellMethod struct {
 	stemcellFinder bwcstem.Finder
+	vmFinder       bwcvm.Finder
 }
 
-func NewDeleteStemcellMethod(stemcellFinder bwcstem.Finder) DeleteStemcellMethod {
-	return DeleteStemcellMethod{stemcellFinder: stemcellFinder}
+func NewDeleteStemcellMethod(stemcellFinder bwcstem.Finder, vmFinder bwcvm.Finder) DeleteStemcellMethod {
+	return DeleteStemcellMethod{
+		stemcellFinder: stemcellFinder,
+		vmFinder:       vmFinder,
+	}
 }
 
 func (a DeleteStemcellMethod) DeleteStemcell(cid apiv1.StemcellCID) error {
@@ -22,7 +29,7 @@ func (a DeleteStemcellMethod) DeleteStemcell(cid apiv1.StemcellCID) error {
 	}
 
 	if found {
-		err := stemcell.Delete()
+		err = stemcell.Delete(func() error { return a.checkUnused(stemcell) })
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Deleting stemcell '%s'", cid)
 		}
@@ -30,3 +37,24 @@ func (a DeleteStemcellMethod) DeleteStemcell(cid apiv1.StemcellCID) error {
 
 	return nil
 }
+
+// checkUnused makes sure that rootfs of existing containers is not removed
+// since that would prevent them from restarting; stemcell calls it
+// while holding lock that keeps new containers from using its image
+func (a DeleteStemcellMethod) checkUnused(stemcell bwcstem.Stemcell) error {
+	vmCIDs, err := a.vmFinder.FindByStemcell(stemcell)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Finding VMs using stemcell '%s'", stemcell.ID())
+	}
+
+	if len(vmCIDs) > 0 {
+		var ids []string
+		for _, vmCID := range vmCIDs {
+			ids = append(ids, vmCID.AsString())
+		}
+
+		return bosherr.Errorf("Stemcell '%s' is still used by VMs: %s", stemcell.ID(), strings.Join(ids, ", "))
+	}
+
+	return nil
+}
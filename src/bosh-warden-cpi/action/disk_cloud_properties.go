@@ -0,0 +1,46 @@
+package action
+
+import (
+	bwcdisk "bosh-warden-cpi/disk"
+)
+
+type DiskCloudProperties struct {
+	Type string `json:"type"` // eg "", tmpfs
+
+	ReadOnly    bool  `json:"read_only"`
+	Preallocate *bool `json:"preallocate"`
+	Encrypted   bool  `json:"encrypted"`
+
+	Filesystem               string `json:"filesystem"`                 // eg "", ext4, xfs
+	InodeRatio               int    `json:"inode_ratio"`                // eg 16384
+	ReservedBlocksPercentage *int   `json:"reserved_blocks_percentage"` // eg 0
+	LazyInit                 *bool  `json:"lazy_init"`
+}
+
+func (cp DiskCloudProperties) AsDiskProps() (bwcdisk.DiskProps, error) {
+	props := bwcdisk.DiskProps{
+		Type: cp.Type,
+
+		ReadOnly:    cp.ReadOnly,
+		Preallocate: cp.Preallocate,
+		Encrypted:   cp.Encrypted,
+
+		Filesystem: cp.Filesystem,
+		FilesystemOpts: bwcdisk.FilesystemOpts{
+			InodeRatio:               cp.InodeRatio,
+			ReservedBlocksPercentage: cp.ReservedBlocksPercentage,
+			LazyInit:                 cp.LazyInit,
+		},
+	}
+
+	if props.Filesystem == "" {
+		props.Filesystem = bwcdisk.FilesystemExt4
+	}
+
+	err := props.Validate()
+	if err != nil {
+		return bwcdisk.DiskProps{}, err
+	}
+
+	return props, nil
+}
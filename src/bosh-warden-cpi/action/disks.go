@@ -2,12 +2,17 @@ package action
 
 import (
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+
+	bwcdisk "bosh-warden-cpi/disk"
 )
 
-type Disks struct{}
+type Disks struct {
+	diskFinder bwcdisk.Finder
+}
 
-func NewDisks() Disks {
-	return Disks{}
+func NewDisks(diskFinder bwcdisk.Finder) Disks {
+	return Disks{diskFinder: diskFinder}
 }
 
 func (d Disks) SetDiskMetadata(cid apiv1.DiskCID, meta apiv1.DiskMeta) error {
@@ -15,5 +20,21 @@ func (d Disks) SetDiskMetadata(cid apiv1.DiskCID, meta apiv1.DiskMeta) error {
 }
 
 func (d Disks) ResizeDisk(cid apiv1.DiskCID, size int) error {
+	disk, err := d.diskFinder.Find(cid)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Finding disk '%s'", cid)
+	}
+
+	// Disks of other backends keep ignoring resize requests
+	resizer, ok := disk.(bwcdisk.Resizer)
+	if !ok {
+		return nil
+	}
+
+	err = resizer.Resize(size)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Resizing disk '%s'", cid)
+	}
+
 	return nil
 }
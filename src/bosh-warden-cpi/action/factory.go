@@ -1,9 +1,10 @@
 package action
 
 import (
+	"runtime"
+
 	wrdnclient "code.cloudfoundry.org/garden/client"
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
-	boshcmd "github.com/cloudfoundry/bosh-utils/fileutil"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	boshsys "github.com/cloudfoundry/bosh-utils/system"
 	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
@@ -24,6 +25,7 @@ type Factory struct {
 
 	diskCreator bwcdisk.Creator
 	diskFinder  bwcdisk.Finder
+	diskChecker bwcdisk.Checker
 }
 
 type CPI struct {
@@ -59,18 +61,40 @@ func NewFactory(
 	logger boshlog.Logger,
 	config Config,
 ) Factory {
-	var decompressor bwcutil.Decompressor
-	if opts.ExpandStemcellTarball {
-		compressor := boshcmd.NewTarballCompressor(cmdRunner, fs)
-		decompressor = bwcutil.NewTarDecompressor(fs, compressor)
-	} else {
-		decompressor = bwcutil.NewGzipDecompressor(fs, cmdRunner)
+	// OCI image layouts are always unpacked regardless of ExpandStemcellTarball
+	ociDecompressor := bwcutil.NewStreamingDecompressor(true, logger)
+
+	decompressor := bwcutil.NewStreamingDecompressor(opts.ExpandStemcellTarball, logger)
+
+	registryMirrors := bwcstem.RegistryMirrors(opts.RegistryMirrors)
+
+	locker := bwcutil.FlockLocker{}
+
+	registryClient := bwcstem.NewRegistryClient(bwcstem.NewRegistryHTTPClient(), opts.RegistryCredentials, fs, logger)
+
+	// Registries are only contacted at import time when operators opted into it
+	// by configuring mirrors or pre-pulling; otherwise Garden resolves images
+	var imageResolver bwcstem.ImageResolver
+	if len(opts.RegistryMirrors) > 0 || opts.PrePullLightStemcells {
+		imageResolver = registryClient
+	}
+
+	var imagePuller bwcstem.ImagePuller
+	if opts.PrePullLightStemcells {
+		imagePuller = registryClient
+	}
+
+	hostArch, err := bwcstem.HostArchitecture()
+	if err != nil {
+		logger.Error("Factory", "Falling back to compiled architecture '%s': %s", runtime.GOARCH, err.Error())
+		hostArch = runtime.GOARCH
 	}
 
 	stemcellImporter := bwcstem.NewCompositeImporter(
-		opts.StemcellsDir, fs, uuidGen, decompressor, logger)
+		opts.StemcellsDir, hostArch, registryMirrors, imageResolver, imagePuller,
+		fs, uuidGen, decompressor, ociDecompressor, locker, logger)
 
-	stemcellFinder := bwcstem.NewCompositeFinder(opts.StemcellsDir, fs, logger)
+	stemcellFinder := bwcstem.NewCompositeFinder(opts.StemcellsDir, registryMirrors, locker, fs, logger)
 
 	sleeper := bwcutil.RealSleeper{}
 
@@ -78,10 +102,11 @@ func NewFactory(
 
 	hostBindMounts := bwcvm.NewFSHostBindMounts(
 		opts.HostEphemeralBindMountsDir, opts.HostPersistentBindMountsDir,
-		sleeper, fs, cmdRunner, logger)
+		opts.AttachDisksAsBlockDevices, opts.DiskEncryptionKeyFile, sleeper, fs, cmdRunner, logger)
 
 	guestBindMounts := bwcvm.NewFSGuestBindMounts(
-		opts.GuestEphemeralBindMountPath, opts.GuestPersistentBindMountsDir, logger)
+		opts.GuestEphemeralBindMountPath, opts.GuestPersistentBindMountsDir,
+		opts.AttachDisksAsBlockDevices, logger)
 
 	systemResolvConfProvider := func() (bwcvm.ResolvConf, error) {
 		return bwcvm.NewSystemResolvConfFromPath(fs)
@@ -93,20 +118,41 @@ func NewFactory(
 
 	vmCreator := bwcvm.NewWardenCreator(
 		uuidGen, wardenClient, metadataService, agentEnvServiceFactory, ports,
-		hostBindMounts, guestBindMounts, systemResolvConfProvider, opts.Agent, logger, config)
+		hostBindMounts, guestBindMounts, systemResolvConfProvider, bwcutil.RealClock{}, opts.Agent, logger, config)
 
 	vmFinder := bwcvm.NewWardenFinder(
 		wardenClient, agentEnvServiceFactory, ports, hostBindMounts, guestBindMounts, logger)
 
-	diskFactory := bwcdisk.NewFSFactory(opts.DisksDir, fs, uuidGen, cmdRunner, logger)
+	var diskCreator bwcdisk.Creator
+	var diskFinder bwcdisk.Finder
+
+	switch opts.DiskBackend {
+	case DiskBackendDirectory:
+		dirFactory := bwcdisk.NewDirFactory(
+			opts.DisksDir, opts.DirectoryDiskQuota, fs, uuidGen, cmdRunner, locker, logger)
+		diskCreator, diskFinder = dirFactory, dirFactory
+
+	case DiskBackendLVM:
+		lvmFactory := bwcdisk.NewLVMFactory(
+			opts.LVMVolumeGroup, opts.LVMThinPool, opts.DisksDir, fs, uuidGen, cmdRunner, logger)
+		diskCreator, diskFinder = lvmFactory, lvmFactory
+
+	default:
+		fsFactory := bwcdisk.NewFSFactory(opts.DisksDir, opts.DiskTemplatesDir, opts.PreallocateDisks,
+			opts.DiskEncryptionKeyFile, fs, uuidGen, cmdRunner, logger)
+		diskCreator, diskFinder = fsFactory, fsFactory
+	}
+
+	diskChecker := bwcdisk.NewFSChecker(opts.DiskCheckMode, opts.AttachDisksAsBlockDevices, cmdRunner, logger)
 
 	return Factory{
 		stemcellImporter,
 		stemcellFinder,
 		vmCreator,
 		vmFinder,
-		diskFactory,
-		diskFactory,
+		diskCreator,
+		diskFinder,
+		diskChecker,
 	}
 }
 
@@ -115,7 +161,7 @@ func (f Factory) New(_ apiv1.CallContext) (apiv1.CPI, error) {
 		NewInfoMethod(),
 
 		NewCreateStemcellMethod(f.stemcellImporter),
-		NewDeleteStemcellMethod(f.stemcellFinder),
+		NewDeleteStemcellMethod(f.stemcellFinder, f.vmFinder),
 
 		NewCreateVMMethod(f.stemcellFinder, f.vmCreator),
 		NewDeleteVMMethod(f.vmFinder),
@@ -127,11 +173,11 @@ func (f Factory) New(_ apiv1.CallContext) (apiv1.CPI, error) {
 
 		NewCreateDiskMethod(f.diskCreator),
 		NewDeleteDiskMethod(f.diskFinder),
-		NewAttachDiskMethod(f.vmFinder, f.diskFinder),
+		NewAttachDiskMethod(f.vmFinder, f.diskFinder, f.diskChecker),
 		NewDetachDiskMethod(f.vmFinder, f.diskFinder),
 		NewHasDiskMethod(f.diskFinder),
 
-		NewDisks(),
-		NewSnapshots(),
+		NewDisks(f.diskFinder),
+		NewSnapshots(f.diskFinder),
 	}, nil
 }
@@ -11,5 +11,5 @@ func NewInfoMethod() InfoMethod {
 }
 
 func (a InfoMethod) Info() (apiv1.Info, error) {
-	return apiv1.Info{StemcellFormats: []string{"warden-tar", "general-tar", "docker-light", "warden-light"}}, nil
+	return apiv1.Info{StemcellFormats: []string{"warden-tar", "general-tar", "docker-light", "warden-light", "warden-oci"}}, nil
 }
@@ -2,18 +2,49 @@ package action
 
 import (
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+
+	bwcdisk "bosh-warden-cpi/disk"
 )
 
-type Snapshots struct{}
+type Snapshots struct {
+	diskFinder bwcdisk.Finder
+}
 
-func NewSnapshots() Snapshots {
-	return Snapshots{}
+func NewSnapshots(diskFinder bwcdisk.Finder) Snapshots {
+	return Snapshots{diskFinder: diskFinder}
 }
 
 func (s Snapshots) SnapshotDisk(cid apiv1.DiskCID, meta apiv1.DiskMeta) (apiv1.SnapshotCID, error) {
-	return apiv1.SnapshotCID{}, nil
+	disk, err := s.diskFinder.Find(cid)
+	if err != nil {
+		return apiv1.SnapshotCID{}, bosherr.WrapErrorf(err, "Finding disk '%s'", cid)
+	}
+
+	// Disks of other backends cannot be snapshotted
+	snapshotter, ok := disk.(bwcdisk.Snapshotter)
+	if !ok {
+		return apiv1.SnapshotCID{}, nil
+	}
+
+	snapshotCID, err := snapshotter.Snapshot()
+	if err != nil {
+		return apiv1.SnapshotCID{}, bosherr.WrapErrorf(err, "Snapshotting disk '%s'", cid)
+	}
+
+	return snapshotCID, nil
 }
 
 func (s Snapshots) DeleteSnapshot(cid apiv1.SnapshotCID) error {
+	deleter, ok := s.diskFinder.(bwcdisk.SnapshotDeleter)
+	if !ok || cid.AsString() == "" {
+		return nil
+	}
+
+	err := deleter.DeleteSnapshot(cid)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting snapshot '%s'", cid)
+	}
+
 	return nil
 }
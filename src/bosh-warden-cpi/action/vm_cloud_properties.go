@@ -10,6 +10,8 @@ import (
 
 type VMCloudProperties struct {
 	Ports []VMCloudPropertiesPort
+
+	InitSystem string `json:"init_system"` // eg "", runit, systemd
 }
 
 type VMCloudPropertiesPort struct {
@@ -38,7 +40,12 @@ func (cp VMCloudProperties) AsVMProps() (bwcvm.VMProps, error) {
 		mappings = append(mappings, mapping)
 	}
 
-	return bwcvm.VMProps{PortMappings: mappings}, nil
+	initSystem, err := bwcvm.NewInitSystemFromString(cp.InitSystem)
+	if err != nil {
+		return bwcvm.VMProps{}, bosherr.WrapError(err, "Validating init_system")
+	}
+
+	return bwcvm.VMProps{PortMappings: mappings, InitSystem: initSystem}, nil
 }
 
 func (cp VMCloudProperties) portMapping(p VMCloudPropertiesPort) (bwcvm.PortMapping, error) {
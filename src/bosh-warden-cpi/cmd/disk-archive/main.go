@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+
+	bwcconfig "bosh-warden-cpi/config"
+	bwcdisk "bosh-warden-cpi/disk"
+)
+
+const usage = `Usage:
+  disk-archive -configPath <cpi.json> export <disk-cid> <archive.tgz>
+  disk-archive -configPath <cpi.json> import <archive.tgz>
+
+Export archives a detached persistent disk with its properties;
+encrypted disks cannot be exported since their key is local to the host.
+Import unpacks such archive as a new persistent disk and prints its CID.
+`
+
+var (
+	configPathOpt = flag.String("configPath", "", "Path to configuration file")
+)
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	logger := boshlog.NewWriterLogger(boshlog.LevelError, os.Stderr)
+	fs := boshsys.NewOsFileSystem(logger)
+	cmdRunner := boshsys.NewExecCmdRunner(logger)
+	uuidGen := boshuuid.NewGenerator()
+
+	config, err := bwcconfig.NewConfigFromPath(*configPathOpt, fs)
+	if err != nil {
+		fail("Loading config: %s", err)
+	}
+
+	backend := config.Actions.DiskBackend
+	if backend != "" && backend != bwcconfig.DiskBackendImage {
+		fail("Archiving '%s' disks is not supported", backend)
+	}
+
+	archiver := bwcdisk.NewFSArchiver(config.Actions.DisksDir, fs, uuidGen, cmdRunner, logger)
+
+	args := flag.Args()
+
+	switch {
+	case len(args) == 3 && args[0] == "export":
+		err = archiver.Export(apiv1.NewDiskCID(args[1]), args[2])
+		if err != nil {
+			fail("Exporting disk: %s", err)
+		}
+
+	case len(args) == 2 && args[0] == "import":
+		cid, err := archiver.Import(args[1])
+		if err != nil {
+			fail("Importing disk: %s", err)
+		}
+		fmt.Println(cid.AsString())
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "disk-archive: "+format+"\n", args...)
+	os.Exit(1)
+}
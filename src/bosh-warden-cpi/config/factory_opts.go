@@ -1,25 +1,90 @@
 package config
 
 import (
+	"strings"
+	"text/template"
+
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 )
 
+const (
+	DiskBackendImage     = "image"
+	DiskBackendDirectory = "directory"
+	DiskBackendLVM       = "lvm"
+)
+
 type FactoryOpts struct {
 	StemcellsDir          string
 	ExpandStemcellTarball bool
 	DisksDir              string
 
+	// Directory with pre-formatted blank disk images used to speed up
+	// disk creation; templates are not used when empty
+	DiskTemplatesDir string
+
+	// Persistent disk backend: image (default), directory or lvm
+	DiskBackend string
+
+	// Thin pool in which lvm backend creates volumes;
+	// DisksDir then only keeps disk metadata
+	LVMVolumeGroup string // e.g. vg0
+	LVMThinPool    string // e.g. pool0
+
+	// Quota enforcing sizes of directory disks: xfs, ext4 or empty to only record sizes
+	DirectoryDiskQuota string
+
+	// Disks that do not set preallocate cloud property are preallocated
+	// instead of being sparse files
+	PreallocateDisks bool
+
 	HostEphemeralBindMountsDir  string // e.g. /var/vcap/store/ephemeral_disks
 	HostPersistentBindMountsDir string // e.g. /var/vcap/store/persistent_disks
 
 	GuestEphemeralBindMountPath  string // e.g. /var/vcap/data
 	GuestPersistentBindMountsDir string // e.g. /warden-cpi-dev
 
+	// Key file protecting LUKS containers of encrypted disks;
+	// disks cannot be encrypted when empty
+	DiskEncryptionKeyFile string
+
+	// Filesystem check before attaching disks: check, repair or empty to skip it
+	DiskCheckMode string
+
+	// Expose persistent disks to the agent as block devices
+	// so that it partitions, formats and mounts them itself
+	AttachDisksAsBlockDevices bool
+
+	// Credentials for registries hosting light stemcell images
+	// keyed by registry host, e.g. registry.example.com:5000
+	RegistryCredentials map[string]RegistryCredentials
+
+	// Light stemcell image reference prefixes rewritten to point at mirrors,
+	// e.g. docker.io/ to registry.local:5000/
+	RegistryMirrors map[string]string
+
+	// Pull light stemcell images into StemcellsDir when stemcells are created
+	// so that creating VMs does not depend on registries being reachable
+	PrePullLightStemcells bool
+
+	// Scripts (text/template) run in new containers to start BOSH Agent keyed by
+	// stemcell operating system and init system, e.g. ubuntu-jammy/runit;
+	// containers without script use built-in script of their init system
+	BootstrapScripts map[string]string
+
+	// Seconds create_vm waits for BOSH Agent to start in container;
+	// create_vm does not wait when 0
+	AgentReadinessTimeout int
+
 	Agent apiv1.AgentOptions
 }
 
+type RegistryCredentials struct {
+	Username string
+	Password string
+}
+
 func (o FactoryOpts) Validate() error {
 	if o.StemcellsDir == "" {
 		return bosherr.Error("Must provide non-empty StemcellsDir")
@@ -29,6 +94,28 @@ func (o FactoryOpts) Validate() error {
 		return bosherr.Error("Must provide non-empty DisksDir")
 	}
 
+	switch o.DiskBackend {
+	case "", DiskBackendImage, DiskBackendDirectory:
+	case DiskBackendLVM:
+		if o.LVMVolumeGroup == "" || o.LVMThinPool == "" {
+			return bosherr.Error("Must provide non-empty LVMVolumeGroup and LVMThinPool for lvm DiskBackend")
+		}
+	default:
+		return bosherr.Errorf("Unsupported DiskBackend '%s'; expected one of: image, directory, lvm", o.DiskBackend)
+	}
+
+	switch o.DirectoryDiskQuota {
+	case "", "xfs", "ext4":
+	default:
+		return bosherr.Errorf("Unsupported DirectoryDiskQuota '%s'; expected one of: xfs, ext4", o.DirectoryDiskQuota)
+	}
+
+	switch o.DiskCheckMode {
+	case "", "check", "repair":
+	default:
+		return bosherr.Errorf("Unsupported DiskCheckMode '%s'; expected one of: check, repair", o.DiskCheckMode)
+	}
+
 	if o.HostEphemeralBindMountsDir == "" {
 		return bosherr.Error("Must provide non-empty HostEphemeralBindMountsDir")
 	}
@@ -45,6 +132,41 @@ func (o FactoryOpts) Validate() error {
 		return bosherr.Error("Must provide non-empty GuestPersistentBindMountsDir")
 	}
 
+	for host, creds := range o.RegistryCredentials {
+		if creds.Username == "" {
+			return bosherr.Errorf("Must provide non-empty Username for registry '%s'", host)
+		}
+	}
+
+	for prefix, mirror := range o.RegistryMirrors {
+		if prefix == "" || mirror == "" {
+			return bosherr.Errorf("Must provide non-empty prefix and mirror for RegistryMirrors entry '%s'", prefix)
+		}
+
+		// Registries are only reached over https
+		if strings.Contains(prefix, "://") || strings.Contains(mirror, "://") {
+			return bosherr.Errorf(
+				"Must provide RegistryMirrors entry '%s' as registry host and path without URL scheme", prefix)
+		}
+	}
+
+	if o.AgentReadinessTimeout < 0 {
+		return bosherr.Error("Must provide non-negative AgentReadinessTimeout")
+	}
+
+	for key, script := range o.BootstrapScripts {
+		os, initSystem, _ := strings.Cut(key, "/")
+		if os == "" || (initSystem != "runit" && initSystem != "systemd") {
+			return bosherr.Errorf(
+				"Must provide BootstrapScripts entry '%s' as '<operating system>/<runit|systemd>'", key)
+		}
+
+		_, err := template.New(key).Parse(script)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing BootstrapScripts entry '%s'", key)
+		}
+	}
+
 	err := o.Agent.Validate()
 	if err != nil {
 		return bosherr.WrapError(err, "Validating Agent configuration")
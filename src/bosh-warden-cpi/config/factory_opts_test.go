@@ -55,6 +55,75 @@ var _ = Describe("FactoryOpts", func() {
 			Expect(err.Error()).To(ContainSubstring("Must provide non-empty DisksDir"))
 		})
 
+		It("returns error if DiskBackend is not supported", func() {
+			opts.DiskBackend = "fake-backend"
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unsupported DiskBackend 'fake-backend'"))
+		})
+
+		It("returns error if DirectoryDiskQuota is not supported", func() {
+			opts.DiskBackend = "directory"
+			opts.DirectoryDiskQuota = "fake-quota"
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unsupported DirectoryDiskQuota 'fake-quota'"))
+		})
+
+		It("returns error if registry credentials do not have username", func() {
+			opts.RegistryCredentials = map[string]RegistryCredentials{
+				"registry.example.com": {Password: "fake-password"},
+			}
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Must provide non-empty Username for registry 'registry.example.com'"))
+		})
+
+		It("returns error if registry mirror is empty", func() {
+			opts.RegistryMirrors = map[string]string{"docker.io/": ""}
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Must provide non-empty prefix and mirror for RegistryMirrors entry 'docker.io/'"))
+		})
+
+		It("returns error if registry mirror has URL scheme", func() {
+			opts.RegistryMirrors = map[string]string{"docker.io/": "http://registry.local:5000/"}
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(
+				"Must provide RegistryMirrors entry 'docker.io/' as registry host and path without URL scheme"))
+		})
+
+		It("returns error if AgentReadinessTimeout is negative", func() {
+			opts.AgentReadinessTimeout = -1
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Must provide non-negative AgentReadinessTimeout"))
+		})
+
+		It("returns error if bootstrap script is not a valid template", func() {
+			opts.BootstrapScripts = map[string]string{"ubuntu-jammy/runit": "exec {{.Missing"}
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Parsing BootstrapScripts entry 'ubuntu-jammy/runit'"))
+		})
+
+		It("returns error if bootstrap script is not keyed by operating system and init system", func() {
+			opts.BootstrapScripts = map[string]string{"ubuntu-jammy": "exec runsvdir-start"}
+
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(
+				"Must provide BootstrapScripts entry 'ubuntu-jammy' as '<operating system>/<runit|systemd>'"))
+		})
+
 		It("returns error if HostEphemeralBindMountsDir is empty", func() {
 			opts.HostEphemeralBindMountsDir = ""
 
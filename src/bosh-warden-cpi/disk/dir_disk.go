@@ -0,0 +1,51 @@
+package disk
+
+import (
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// DirDisk is a persistent disk backed by a plain directory
+type DirDisk struct {
+	id        apiv1.DiskCID
+	path      string
+	props     DiskProps
+	projectID uint32
+
+	quota  dirQuota
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func (s DirDisk) ID() apiv1.DiskCID { return s.id }
+
+func (s DirDisk) Path() string { return s.path }
+
+func (s DirDisk) Props() DiskProps { return s.props }
+
+func (s DirDisk) Exists() (bool, error) {
+	return s.fs.FileExists(s.path), nil
+}
+
+func (s DirDisk) Delete() error {
+	err := s.fs.RemoveAll(s.path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting disk '%s'", s.path)
+	}
+
+	// Limit is cleared after contents are gone so that a stale limit
+	// does not outlive the disk if removing contents fails
+	err = s.quota.Clear(s.projectID)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Clearing quota of disk '%s'", s.path)
+	}
+
+	err = s.fs.RemoveAll(metadataPath(s.path))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting disk metadata '%s'", metadataPath(s.path))
+	}
+
+	return nil
+}
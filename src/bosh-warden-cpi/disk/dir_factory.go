@@ -0,0 +1,172 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+
+	"bosh-warden-cpi/util"
+)
+
+// DirFactory creates persistent disks as plain directories which
+// do not require loop devices to be attached to VMs
+type DirFactory struct {
+	dirPath string
+	quota   dirQuota
+
+	fs      boshsys.FileSystem
+	uuidGen boshuuid.Generator
+	locker  util.FileLocker
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func NewDirFactory(
+	dirPath string,
+	quotaMode string,
+	fs boshsys.FileSystem,
+	uuidGen boshuuid.Generator,
+	cmdRunner boshsys.CmdRunner,
+	locker util.FileLocker,
+	logger boshlog.Logger,
+) DirFactory {
+	return DirFactory{
+		dirPath: dirPath,
+		quota:   newDirQuota(quotaMode, dirPath, cmdRunner),
+
+		fs:      fs,
+		uuidGen: uuidGen,
+		locker:  locker,
+
+		logTag: "disk.DirFactory",
+		logger: logger,
+	}
+}
+
+func (f DirFactory) Create(size int, props DiskProps) (Disk, error) {
+	f.logger.Debug(f.logTag, "Creating directory disk of size '%d'", size)
+
+	if props.Type != "" && props.Type != DiskTypeImage {
+		return nil, bosherr.Errorf("Disk type '%s' is not supported by configured disk backend", props.Type)
+	}
+
+	if props.Encrypted {
+		return nil, bosherr.Error("Directory disks cannot be encrypted")
+	}
+
+	id, err := f.uuidGen.Generate()
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating disk id")
+	}
+
+	diskPath := filepath.Join(f.dirPath, id)
+
+	err = f.fs.MkdirAll(diskPath, os.FileMode(0755))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating disk directory")
+	}
+
+	props.Type = DiskTypeDirectory
+
+	// Project ID stays reserved by other processes only once metadata is saved
+	unlock, err := f.locker.Lock(f.projectIDsLockPath())
+	if err != nil {
+		f.cleanUp(diskPath)
+		return nil, bosherr.WrapError(err, "Locking project IDs")
+	}
+
+	defer unlock()
+
+	takenProjectIDs, err := f.takenProjectIDs()
+	if err != nil {
+		f.cleanUp(diskPath)
+		return nil, err
+	}
+
+	metadata := fsMetadata{Props: props, Size: size, ProjectID: f.quota.projectID(id, takenProjectIDs)}
+
+	err = f.quota.Set(diskPath, metadata.ProjectID, size)
+	if err != nil {
+		f.cleanUp(diskPath)
+		return nil, bosherr.WrapErrorf(err, "Limiting disk size to '%dM'", size)
+	}
+
+	err = saveMetadata(f.fs, diskPath, metadata)
+	if err != nil {
+		f.cleanUp(diskPath)
+		return nil, err
+	}
+
+	return f.newDisk(apiv1.NewDiskCID(id), diskPath, metadata), nil
+}
+
+func (f DirFactory) Find(id apiv1.DiskCID) (Disk, error) {
+	diskPath := filepath.Join(f.dirPath, id.AsString())
+
+	metadata, err := loadMetadata(f.fs, diskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.Props.Type = DiskTypeDirectory
+
+	return f.newDisk(id, diskPath, metadata), nil
+}
+
+// takenProjectIDs collects project IDs recorded in metadata of existing disks
+func (f DirFactory) takenProjectIDs() (map[uint32]bool, error) {
+	metadataPaths, err := f.fs.Glob(metadataPath(filepath.Join(f.dirPath, "*")))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Listing disk metadata")
+	}
+
+	taken := map[uint32]bool{}
+
+	for _, path := range metadataPaths {
+		metadata, err := loadMetadata(f.fs, strings.TrimSuffix(path, ".json"))
+		if err != nil {
+			return nil, err
+		}
+
+		if metadata.ProjectID != 0 {
+			taken[metadata.ProjectID] = true
+		}
+	}
+
+	return taken, nil
+}
+
+// projectIDsLockPath guards allocating project IDs
+// across concurrently running CPI processes
+func (f DirFactory) projectIDsLockPath() string {
+	return filepath.Join(f.dirPath, ".project-ids.lock")
+}
+
+func (f DirFactory) newDisk(id apiv1.DiskCID, diskPath string, metadata fsMetadata) DirDisk {
+	return DirDisk{
+		id:        id,
+		path:      diskPath,
+		props:     metadata.Props,
+		projectID: metadata.ProjectID,
+
+		quota:  f.quota,
+		fs:     f.fs,
+		logger: f.logger,
+	}
+}
+
+func (f DirFactory) cleanUp(path string) {
+	for _, p := range []string{path, metadataPath(path)} {
+		err := f.fs.RemoveAll(p)
+		if err != nil {
+			f.logger.Error(f.logTag, "Failed deleting '%s': %s", p, err.Error())
+		}
+	}
+}
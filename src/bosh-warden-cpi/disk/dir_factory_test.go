@@ -0,0 +1,203 @@
+package disk_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-utils/uuid/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/disk"
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("DirFactory", func() {
+	const projectID = "1305718364" // derived from 'fake-uuid'
+
+	var (
+		fs        *fakesys.FakeFileSystem
+		uuidGen   *fakeuuid.FakeGenerator
+		cmdRunner *fakesys.FakeCmdRunner
+		locker    *util.RecordingNoopLocker
+		logger    boshlog.Logger
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-uuid"}
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		locker = util.NewRecordingNoopLocker()
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+
+		cmdRunner.AddCmdResult("findmnt --noheadings --output TARGET --target /fake-disks-dir", fakesys.FakeCmdResult{
+			Stdout: "/fake-store\n",
+			Sticky: true,
+		})
+	})
+
+	Describe("Create", func() {
+		It("creates directory disk and records its size", func() {
+			factory := NewDirFactory("/fake-disks-dir", "", fs, uuidGen, cmdRunner, locker, logger)
+
+			disk, err := factory.Create(40, DiskProps{ReadOnly: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disk.ID()).To(Equal(apiv1.NewDiskCID("fake-uuid")))
+			Expect(disk.Path()).To(Equal("/fake-disks-dir/fake-uuid"))
+			Expect(disk.Props()).To(Equal(DiskProps{Type: DiskTypeDirectory, ReadOnly: true}))
+
+			pathStat := fs.GetFileTestStat("/fake-disks-dir/fake-uuid")
+			Expect(pathStat.FileType).To(Equal(fakesys.FakeFileTypeDir))
+
+			contents, err := fs.ReadFileString("/fake-disks-dir/fake-uuid.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(ContainSubstring(`"Size":40`))
+			Expect(contents).To(ContainSubstring(`"Type":"directory"`))
+
+			Expect(cmdRunner.RunCommands).To(BeEmpty())
+		})
+
+		It("limits directory with xfs project quota", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaXFS, fs, uuidGen, cmdRunner, locker, logger)
+
+			_, err := factory.Create(40, DiskProps{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"findmnt", "--noheadings", "--output", "TARGET", "--target", "/fake-disks-dir"},
+				{"xfs_quota", "-x", "-c", "project -s -p /fake-disks-dir/fake-uuid " + projectID, "/fake-store"},
+				{"xfs_quota", "-x", "-c", "limit -p bhard=40m " + projectID, "/fake-store"},
+			}))
+		})
+
+		It("limits directory with ext4 project quota", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaExt4, fs, uuidGen, cmdRunner, locker, logger)
+
+			_, err := factory.Create(40, DiskProps{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"findmnt", "--noheadings", "--output", "TARGET", "--target", "/fake-disks-dir"},
+				{"chattr", "-p", projectID, "+P", "/fake-disks-dir/fake-uuid"},
+				{"setquota", "-P", projectID, "0", "40960", "0", "0", "/fake-store"},
+			}))
+		})
+
+		It("allocates project ID under lock", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaXFS, fs, uuidGen, cmdRunner, locker, logger)
+
+			_, err := factory.Create(40, DiskProps{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(locker.LockedPaths()).To(Equal([]string{"/fake-disks-dir/.project-ids.lock"}))
+			Expect(locker.IsHeld("/fake-disks-dir/.project-ids.lock")).To(BeFalse())
+		})
+
+		It("skips project IDs recorded by other disks", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaXFS, fs, uuidGen, cmdRunner, locker, logger)
+
+			fs.SetGlob("/fake-disks-dir/*.json", []string{
+				"/fake-disks-dir/fake-other-id-1.json",
+				"/fake-disks-dir/fake-other-id-2.json",
+			})
+
+			err := fs.WriteFileString("/fake-disks-dir/fake-other-id-1.json", `{"ProjectID":`+projectID+`}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-disks-dir/fake-other-id-2.json", `{"ProjectID":1305718365}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = factory.Create(40, DiskProps{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"findmnt", "--noheadings", "--output", "TARGET", "--target", "/fake-disks-dir"},
+				{"xfs_quota", "-x", "-c", "project -s -p /fake-disks-dir/fake-uuid 1305718366", "/fake-store"},
+				{"xfs_quota", "-x", "-c", "limit -p bhard=40m 1305718366", "/fake-store"},
+			}))
+
+			contents, err := fs.ReadFileString("/fake-disks-dir/fake-uuid.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(ContainSubstring(`"ProjectID":1305718366`))
+		})
+
+		It("returns error and deletes directory if listing recorded project IDs fails", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaXFS, fs, uuidGen, cmdRunner, locker, logger)
+
+			fs.GlobErr = errors.New("fake-glob-err")
+
+			_, err := factory.Create(40, DiskProps{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-glob-err"))
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+			Expect(cmdRunner.RunCommands).To(BeEmpty())
+		})
+
+		It("returns error and deletes directory if limiting its size fails", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaXFS, fs, uuidGen, cmdRunner, locker, logger)
+
+			cmdRunner.AddCmdResult(
+				"xfs_quota -x -c limit -p bhard=40m "+projectID+" /fake-store",
+				fakesys.FakeCmdResult{Error: errors.New("fake-quota-err")},
+			)
+
+			disk, err := factory.Create(40, DiskProps{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-quota-err"))
+			Expect(disk).To(BeNil())
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+		})
+
+		It("returns error if generating disk id fails", func() {
+			factory := NewDirFactory("/fake-disks-dir", "", fs, uuidGen, cmdRunner, locker, logger)
+			uuidGen.GenerateError = errors.New("fake-generate-err")
+
+			_, err := factory.Create(40, DiskProps{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-generate-err"))
+		})
+	})
+
+	Describe("Find", func() {
+		It("returns directory disk with recorded properties", func() {
+			factory := NewDirFactory("/fake-disks-dir", "", fs, uuidGen, cmdRunner, locker, logger)
+
+			err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", `{"Props":{"ReadOnly":true}}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			disk, err := factory.Find(apiv1.NewDiskCID("fake-disk-id"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disk.Path()).To(Equal("/fake-disks-dir/fake-disk-id"))
+			Expect(disk.Props()).To(Equal(DiskProps{Type: DiskTypeDirectory, ReadOnly: true}))
+		})
+	})
+
+	Describe("deleting disk", func() {
+		It("deletes directory, its metadata and clears its quota", func() {
+			factory := NewDirFactory("/fake-disks-dir", DirQuotaXFS, fs, uuidGen, cmdRunner, locker, logger)
+
+			disk, err := factory.Create(40, DiskProps{})
+			Expect(err).ToNot(HaveOccurred())
+
+			cmdRunner.ClearCommandHistory()
+
+			disk, err = factory.Find(disk.ID())
+			Expect(err).ToNot(HaveOccurred())
+
+			err = disk.Delete()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid.json")).To(BeFalse())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"findmnt", "--noheadings", "--output", "TARGET", "--target", "/fake-disks-dir"},
+				{"xfs_quota", "-x", "-c", "limit -p bhard=0 " + projectID, "/fake-store"},
+			}))
+		})
+	})
+})
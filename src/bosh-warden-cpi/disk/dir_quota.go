@@ -0,0 +1,132 @@
+package disk
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const (
+	DirQuotaXFS  = "xfs"
+	DirQuotaExt4 = "ext4"
+	DirQuotaNone = "" // sizes are only recorded
+)
+
+// dirQuota enforces sizes of directory disks with filesystem project quotas.
+// Disks directory must be on a filesystem mounted with project quotas enabled
+// (prjquota for xfs, quota feature with project option for ext4).
+type dirQuota struct {
+	mode    string
+	dirPath string
+
+	cmdRunner boshsys.CmdRunner
+}
+
+func newDirQuota(mode, dirPath string, cmdRunner boshsys.CmdRunner) dirQuota {
+	return dirQuota{mode: mode, dirPath: dirPath, cmdRunner: cmdRunner}
+}
+
+// projectID derives project ID from disk ID and probes for the next one
+// not taken by another disk since checksums of different IDs may collide;
+// 0 is reserved by quota tools
+func (q dirQuota) projectID(id string, taken map[uint32]bool) uint32 {
+	projectID := crc32.ChecksumIEEE([]byte(id)) & 0x7fffffff
+
+	for projectID == 0 || taken[projectID] {
+		projectID = (projectID + 1) & 0x7fffffff
+	}
+
+	return projectID
+}
+
+// Set assigns directory to given project and limits project to size in MB
+func (q dirQuota) Set(path string, projectID uint32, size int) error {
+	if q.mode == DirQuotaNone {
+		return nil
+	}
+
+	mountPoint, err := q.mountPoint()
+	if err != nil {
+		return err
+	}
+
+	projectIDStr := strconv.FormatUint(uint64(projectID), 10)
+
+	switch q.mode {
+	case DirQuotaXFS:
+		err = q.runXFSQuota(mountPoint, fmt.Sprintf("project -s -p %s %s", path, projectIDStr))
+		if err != nil {
+			return err
+		}
+
+		return q.runXFSQuota(mountPoint, fmt.Sprintf("limit -p bhard=%dm %s", size, projectIDStr))
+
+	case DirQuotaExt4:
+		_, _, _, err = q.cmdRunner.RunCommand("chattr", "-p", projectIDStr, "+P", path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Assigning project '%s' to '%s'", projectIDStr, path)
+		}
+
+		return q.runSetQuota(mountPoint, projectIDStr, size*1024)
+
+	default:
+		return bosherr.Errorf("Unsupported directory disk quota '%s'", q.mode)
+	}
+}
+
+// Clear removes limit of given project
+func (q dirQuota) Clear(projectID uint32) error {
+	if q.mode == DirQuotaNone || projectID == 0 {
+		return nil
+	}
+
+	mountPoint, err := q.mountPoint()
+	if err != nil {
+		return err
+	}
+
+	projectIDStr := strconv.FormatUint(uint64(projectID), 10)
+
+	switch q.mode {
+	case DirQuotaXFS:
+		return q.runXFSQuota(mountPoint, "limit -p bhard=0 "+projectIDStr)
+	case DirQuotaExt4:
+		return q.runSetQuota(mountPoint, projectIDStr, 0)
+	default:
+		return bosherr.Errorf("Unsupported directory disk quota '%s'", q.mode)
+	}
+}
+
+func (q dirQuota) mountPoint() (string, error) {
+	stdout, _, _, err := q.cmdRunner.RunCommand(
+		"findmnt", "--noheadings", "--output", "TARGET", "--target", q.dirPath)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Finding mount point of '%s'", q.dirPath)
+	}
+
+	return strings.TrimSpace(stdout), nil
+}
+
+func (q dirQuota) runXFSQuota(mountPoint, cmd string) error {
+	_, _, _, err := q.cmdRunner.RunCommand("xfs_quota", "-x", "-c", cmd, mountPoint)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Running xfs_quota '%s'", cmd)
+	}
+
+	return nil
+}
+
+// runSetQuota sets hard block limit in KB; 0 removes the limit
+func (q dirQuota) runSetQuota(mountPoint, projectIDStr string, blocksHardKB int) error {
+	_, _, _, err := q.cmdRunner.RunCommand(
+		"setquota", "-P", projectIDStr, "0", strconv.Itoa(blocksHardKB), "0", "0", mountPoint)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Setting quota of project '%s'", projectIDStr)
+	}
+
+	return nil
+}
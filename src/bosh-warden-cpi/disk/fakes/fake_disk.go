@@ -2,11 +2,14 @@ package fakes
 
 import (
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+
+	bwcdisk "bosh-warden-cpi/disk"
 )
 
 type FakeDisk struct {
-	id   apiv1.DiskCID
-	path string
+	id    apiv1.DiskCID
+	path  string
+	props bwcdisk.DiskProps
 
 	DeleteCalled bool
 	DeleteErr    error
@@ -20,10 +23,16 @@ func NewFakeDiskWithPath(id apiv1.DiskCID, path string) *FakeDisk {
 	return &FakeDisk{id: id, path: path}
 }
 
+func NewFakeDiskWithProps(id apiv1.DiskCID, path string, props bwcdisk.DiskProps) *FakeDisk {
+	return &FakeDisk{id: id, path: path, props: props}
+}
+
 func (s FakeDisk) ID() apiv1.DiskCID { return s.id }
 
 func (s FakeDisk) Path() string { return s.path }
 
+func (s FakeDisk) Props() bwcdisk.DiskProps { return s.props }
+
 func (s *FakeDisk) Exists() (bool, error) { return false, nil }
 
 func (s *FakeDisk) Delete() error {
@@ -7,17 +7,19 @@ import (
 )
 
 type FakeFactory struct {
-	CreateSize int
-	CreateDisk bwcdisk.Disk
-	CreateErr  error
+	CreateSize  int
+	CreateProps bwcdisk.DiskProps
+	CreateDisk  bwcdisk.Disk
+	CreateErr   error
 
 	FindID   apiv1.DiskCID
 	FindDisk bwcdisk.Disk
 	FindErr  error
 }
 
-func (f *FakeFactory) Create(size int) (bwcdisk.Disk, error) {
+func (f *FakeFactory) Create(size int, props bwcdisk.DiskProps) (bwcdisk.Disk, error) {
 	f.CreateSize = size
+	f.CreateProps = props
 	return f.CreateDisk, f.CreateErr
 }
 
@@ -0,0 +1,112 @@
+package disk
+
+import (
+	"strconv"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	FilesystemExt4 = "ext4"
+	FilesystemXFS  = "xfs"
+)
+
+// FilesystemOpts tune mkfs; zero values keep mkfs defaults
+type FilesystemOpts struct {
+	InodeRatio               int   // bytes per inode, e.g. 16384
+	ReservedBlocksPercentage *int  // e.g. 0 to leave no blocks for root
+	LazyInit                 *bool // lazily initialize inode tables and journal
+}
+
+func (p DiskProps) Validate() error {
+	switch p.Type {
+	case "", DiskTypeImage:
+	case DiskTypeTmpfs:
+		if p.Encrypted {
+			return bosherr.Error("tmpfs disks cannot be encrypted")
+		}
+		// Empty tmpfs mounted read-only could never be written to
+		if p.ReadOnly {
+			return bosherr.Error("tmpfs disks cannot be read-only")
+		}
+		return nil
+	default:
+		return bosherr.Errorf("Unsupported disk type '%s'; expected one of: image, tmpfs", p.Type)
+	}
+
+	switch p.filesystem() {
+	case FilesystemExt4:
+		return p.FilesystemOpts.validateExt4()
+	case FilesystemXFS:
+		return p.FilesystemOpts.validateXFS()
+	default:
+		return bosherr.Errorf("Unsupported filesystem '%s'; expected one of: ext4, xfs", p.Filesystem)
+	}
+}
+
+func (p DiskProps) filesystem() string {
+	if p.Filesystem == "" {
+		return FilesystemExt4
+	}
+
+	return p.Filesystem
+}
+
+// mkfsArgs returns arguments for /sbin/mkfs that format disk at given path
+func (p DiskProps) mkfsArgs(path string) []string {
+	opts := p.FilesystemOpts
+
+	if p.filesystem() == FilesystemXFS {
+		return []string{"-t", FilesystemXFS, "-f", path}
+	}
+
+	args := []string{"-t", FilesystemExt4, "-F"}
+
+	if opts.InodeRatio != 0 {
+		args = append(args, "-i", strconv.Itoa(opts.InodeRatio))
+	}
+
+	if opts.ReservedBlocksPercentage != nil {
+		args = append(args, "-m", strconv.Itoa(*opts.ReservedBlocksPercentage))
+	}
+
+	if opts.LazyInit != nil {
+		lazy := "0"
+		if *opts.LazyInit {
+			lazy = "1"
+		}
+		args = append(args, "-E", "lazy_itable_init="+lazy+",lazy_journal_init="+lazy)
+	}
+
+	return append(args, path)
+}
+
+func (o FilesystemOpts) validateExt4() error {
+	if o.InodeRatio != 0 && (o.InodeRatio < 1024 || o.InodeRatio > 67108864) {
+		return bosherr.Errorf("Inode ratio '%d' must be between 1024 and 67108864", o.InodeRatio)
+	}
+
+	if o.ReservedBlocksPercentage != nil {
+		if *o.ReservedBlocksPercentage < 0 || *o.ReservedBlocksPercentage > 50 {
+			return bosherr.Errorf("Reserved blocks percentage '%d' must be between 0 and 50", *o.ReservedBlocksPercentage)
+		}
+	}
+
+	return nil
+}
+
+func (o FilesystemOpts) validateXFS() error {
+	if o.InodeRatio != 0 {
+		return bosherr.Error("Inode ratio is not supported by xfs")
+	}
+
+	if o.ReservedBlocksPercentage != nil {
+		return bosherr.Error("Reserved blocks percentage is not supported by xfs")
+	}
+
+	if o.LazyInit != nil {
+		return bosherr.Error("Lazy init is not supported by xfs")
+	}
+
+	return nil
+}
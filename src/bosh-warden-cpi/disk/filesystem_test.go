@@ -0,0 +1,96 @@
+package disk_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/disk"
+)
+
+var _ = Describe("DiskProps", func() {
+	Describe("Validate", func() {
+		var (
+			zero = 0
+			yes  = true
+		)
+
+		It("does not return error for default ext4 filesystem", func() {
+			err := DiskProps{}.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not return error for ext4 with all options set", func() {
+			err := DiskProps{
+				Filesystem: "ext4",
+				FilesystemOpts: FilesystemOpts{
+					InodeRatio:               16384,
+					ReservedBlocksPercentage: &zero,
+					LazyInit:                 &yes,
+				},
+			}.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not return error for xfs without options", func() {
+			err := DiskProps{Filesystem: "xfs"}.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not return error for tmpfs disk", func() {
+			err := DiskProps{Type: DiskTypeTmpfs}.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns error for encrypted tmpfs disk", func() {
+			err := DiskProps{Type: DiskTypeTmpfs, Encrypted: true}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tmpfs disks cannot be encrypted"))
+		})
+
+		It("returns error for read-only tmpfs disk", func() {
+			err := DiskProps{Type: DiskTypeTmpfs, ReadOnly: true}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tmpfs disks cannot be read-only"))
+		})
+
+		It("returns error for unsupported disk type", func() {
+			err := DiskProps{Type: "fake-type"}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unsupported disk type 'fake-type'"))
+		})
+
+		It("returns error for unsupported filesystem", func() {
+			err := DiskProps{Filesystem: "btrfs"}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unsupported filesystem 'btrfs'"))
+		})
+
+		It("returns error if inode ratio is out of range", func() {
+			err := DiskProps{FilesystemOpts: FilesystemOpts{InodeRatio: 512}}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Inode ratio '512' must be between 1024 and 67108864"))
+		})
+
+		It("returns error if reserved blocks percentage is out of range", func() {
+			tooMany := 51
+
+			err := DiskProps{FilesystemOpts: FilesystemOpts{ReservedBlocksPercentage: &tooMany}}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Reserved blocks percentage '51' must be between 0 and 50"))
+		})
+
+		It("returns error if ext4 specific options are used with xfs", func() {
+			err := DiskProps{Filesystem: "xfs", FilesystemOpts: FilesystemOpts{InodeRatio: 16384}}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Inode ratio is not supported by xfs"))
+
+			err = DiskProps{Filesystem: "xfs", FilesystemOpts: FilesystemOpts{ReservedBlocksPercentage: &zero}}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Reserved blocks percentage is not supported by xfs"))
+
+			err = DiskProps{Filesystem: "xfs", FilesystemOpts: FilesystemOpts{LazyInit: &yes}}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Lazy init is not supported by xfs"))
+		})
+	})
+})
@@ -0,0 +1,224 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+)
+
+// Disk image entry name in archives; metadata entry is image.json
+const archiveImageName = "image"
+
+// FSArchiver exports disk images made by FSFactory into gzipped
+// tarballs (image and image.json entries) and imports them back
+// under new disk ids; holes in sparse images are preserved
+type FSArchiver struct {
+	dirPath string
+
+	fs        boshsys.FileSystem
+	uuidGen   boshuuid.Generator
+	cmdRunner boshsys.CmdRunner
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func NewFSArchiver(
+	dirPath string,
+	fs boshsys.FileSystem,
+	uuidGen boshuuid.Generator,
+	cmdRunner boshsys.CmdRunner,
+	logger boshlog.Logger,
+) FSArchiver {
+	return FSArchiver{
+		dirPath: dirPath,
+
+		fs:        fs,
+		uuidGen:   uuidGen,
+		cmdRunner: cmdRunner,
+
+		logTag: "disk.FSArchiver",
+		logger: logger,
+	}
+}
+
+// Export archives detached disk; attached disks are refused
+// since their images may change while they are being read
+func (a FSArchiver) Export(id apiv1.DiskCID, archivePath string) error {
+	diskPath := filepath.Join(a.dirPath, id.AsString())
+
+	if !a.fs.FileExists(diskPath) {
+		return bosherr.Errorf("Disk '%s' does not exist", id.AsString())
+	}
+
+	metadata, err := loadMetadata(a.fs, diskPath)
+	if err != nil {
+		return err
+	}
+
+	if metadata.Props.Type == DiskTypeTmpfs {
+		return bosherr.Errorf("Exporting tmpfs disk '%s' is not supported", id.AsString())
+	}
+
+	// LUKS key file is local to this host hence archive could not be opened elsewhere
+	if metadata.Props.Encrypted {
+		return bosherr.Errorf("Exporting encrypted disk '%s' is not supported", id.AsString())
+	}
+
+	stdout, _, _, err := a.cmdRunner.RunCommand("losetup", "--associated", diskPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking whether disk '%s' is attached", id.AsString())
+	}
+
+	if strings.TrimSpace(stdout) != "" {
+		return bosherr.Errorf("Disk '%s' is attached; detach it before exporting", id.AsString())
+	}
+
+	entries := []string{id.AsString()}
+
+	// Disks created before metadata was recorded have none
+	if a.fs.FileExists(metadataPath(diskPath)) {
+		entries = append(entries, filepath.Base(metadataPath(diskPath)))
+	}
+
+	args := []string{
+		"--create", "--gzip", "--sparse",
+		"--file", archivePath,
+		"--directory", a.dirPath,
+		"--transform", "s,^" + id.AsString() + "," + archiveImageName + ",",
+	}
+
+	_, _, _, err = a.cmdRunner.RunCommand("tar", append(args, entries...)...)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Archiving disk '%s'", id.AsString())
+	}
+
+	return nil
+}
+
+// Import unpacks archived disk under a new disk id
+func (a FSArchiver) Import(archivePath string) (apiv1.DiskCID, error) {
+	id, err := a.uuidGen.Generate()
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapError(err, "Generating disk id")
+	}
+
+	// Unpacking next to disks keeps final renames on the same filesystem
+	tmpDir := filepath.Join(a.dirPath, ".import-"+id)
+
+	err = a.fs.MkdirAll(tmpDir, os.FileMode(0755))
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapError(err, "Making import directory")
+	}
+
+	defer func() {
+		err := a.fs.RemoveAll(tmpDir)
+		if err != nil {
+			a.logger.Error(a.logTag, "Failed deleting '%s': %s", tmpDir, err.Error())
+		}
+	}()
+
+	// Archives may come from elsewhere hence unpacked files
+	// must not keep ownership recorded in them
+	_, _, _, err = a.cmdRunner.RunCommand(
+		"tar", "--extract", "--gzip", "--no-same-owner", "--file", archivePath, "--directory", tmpDir)
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapErrorf(err, "Unpacking disk archive '%s'", archivePath)
+	}
+
+	tmpImagePath := filepath.Join(tmpDir, archiveImageName)
+
+	if !a.fs.FileExists(tmpImagePath) {
+		return apiv1.DiskCID{}, bosherr.Errorf("Disk archive '%s' does not contain disk image", archivePath)
+	}
+
+	err = a.checkRegularFile(tmpImagePath, archivePath)
+	if err != nil {
+		return apiv1.DiskCID{}, err
+	}
+
+	if a.fs.FileExists(metadataPath(tmpImagePath)) {
+		err = a.checkRegularFile(metadataPath(tmpImagePath), archivePath)
+		if err != nil {
+			return apiv1.DiskCID{}, err
+		}
+	}
+
+	metadata, err := loadMetadata(a.fs, tmpImagePath)
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapErrorf(err, "Validating disk archive '%s'", archivePath)
+	}
+
+	err = a.checkMetadata(metadata)
+	if err != nil {
+		return apiv1.DiskCID{}, bosherr.WrapErrorf(err, "Validating disk archive '%s'", archivePath)
+	}
+
+	diskPath := filepath.Join(a.dirPath, id)
+
+	if a.fs.FileExists(metadataPath(tmpImagePath)) {
+		err = a.fs.Rename(metadataPath(tmpImagePath), metadataPath(diskPath))
+		if err != nil {
+			return apiv1.DiskCID{}, bosherr.WrapError(err, "Moving disk metadata")
+		}
+	}
+
+	// Image is moved last so that disk never appears without its metadata
+	err = a.fs.Rename(tmpImagePath, diskPath)
+	if err != nil {
+		removeErr := a.fs.RemoveAll(metadataPath(diskPath))
+		if removeErr != nil {
+			a.logger.Error(a.logTag, "Failed deleting '%s': %s", metadataPath(diskPath), removeErr.Error())
+		}
+		return apiv1.DiskCID{}, bosherr.WrapError(err, "Moving disk image")
+	}
+
+	return apiv1.NewDiskCID(id), nil
+}
+
+// checkMetadata only accepts metadata of disks that Export produces since
+// archived properties decide how imported image is later attached
+func (a FSArchiver) checkMetadata(metadata fsMetadata) error {
+	switch metadata.Props.Type {
+	case "", DiskTypeImage:
+	default:
+		return bosherr.Errorf("Importing %s disks is not supported", metadata.Props.Type)
+	}
+
+	if metadata.Props.Encrypted {
+		return bosherr.Error("Importing encrypted disks is not supported")
+	}
+
+	if metadata.Size < 0 {
+		return bosherr.Errorf("Disk size '%d' must not be negative", metadata.Size)
+	}
+
+	err := metadata.Props.Validate()
+	if err != nil {
+		return bosherr.WrapError(err, "Validating disk properties")
+	}
+
+	return nil
+}
+
+// checkRegularFile refuses unpacked entries that are symlinks or device nodes
+// since moving them under disks dir would expose arbitrary host files as disks
+func (a FSArchiver) checkRegularFile(path, archivePath string) error {
+	info, err := a.fs.Lstat(path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking unpacked '%s'", filepath.Base(path))
+	}
+
+	if !info.Mode().IsRegular() {
+		return bosherr.Errorf("Disk archive '%s' contains '%s' that is not a regular file",
+			archivePath, filepath.Base(path))
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package disk_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-utils/uuid/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/disk"
+)
+
+var _ = Describe("FSArchiver", func() {
+	var (
+		fs        *fakesys.FakeFileSystem
+		uuidGen   *fakeuuid.FakeGenerator
+		cmdRunner *fakesys.FakeCmdRunner
+		archiver  FSArchiver
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-uuid"}
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		archiver = NewFSArchiver("/fake-disks-dir", fs, uuidGen, cmdRunner, logger)
+	})
+
+	Describe("Export", func() {
+		BeforeEach(func() {
+			err := fs.WriteFile("/fake-disks-dir/fake-disk-id", []byte{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("archives sparse disk image and its metadata under fixed names", func() {
+			err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", "{}")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = archiver.Export(apiv1.NewDiskCID("fake-disk-id"), "/fake-archive.tgz")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"losetup", "--associated", "/fake-disks-dir/fake-disk-id"},
+				{
+					"tar", "--create", "--gzip", "--sparse",
+					"--file", "/fake-archive.tgz",
+					"--directory", "/fake-disks-dir",
+					"--transform", "s,^fake-disk-id,image,",
+					"fake-disk-id", "fake-disk-id.json",
+				},
+			}))
+		})
+
+		It("archives only disk image if disk has no metadata", func() {
+			err := archiver.Export(apiv1.NewDiskCID("fake-disk-id"), "/fake-archive.tgz")
+			Expect(err).ToNot(HaveOccurred())
+
+			tarCmd := cmdRunner.RunCommands[1]
+			Expect(tarCmd[len(tarCmd)-1]).To(Equal("fake-disk-id"))
+		})
+
+		It("returns error if disk is attached", func() {
+			cmdRunner.AddCmdResult("losetup --associated /fake-disks-dir/fake-disk-id", fakesys.FakeCmdResult{
+				Stdout: "/dev/loop3: [2049]:1234 (/fake-disks-dir/fake-disk-id)\n",
+			})
+
+			err := archiver.Export(apiv1.NewDiskCID("fake-disk-id"), "/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Disk 'fake-disk-id' is attached"))
+			Expect(cmdRunner.RunCommands).To(HaveLen(1))
+		})
+
+		It("returns error if disk is encrypted", func() {
+			err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", `{"Props":{"Encrypted":true}}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = archiver.Export(apiv1.NewDiskCID("fake-disk-id"), "/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Exporting encrypted disk 'fake-disk-id' is not supported"))
+			Expect(cmdRunner.RunCommands).To(BeEmpty())
+		})
+
+		It("returns error if disk does not exist", func() {
+			err := archiver.Export(apiv1.NewDiskCID("fake-other-id"), "/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Disk 'fake-other-id' does not exist"))
+		})
+
+		It("returns error if archiving fails", func() {
+			cmdRunner.AddCmdResult(
+				"tar --create --gzip --sparse --file /fake-archive.tgz --directory /fake-disks-dir "+
+					"--transform s,^fake-disk-id,image, fake-disk-id",
+				fakesys.FakeCmdResult{Error: errors.New("fake-tar-err")},
+			)
+
+			err := archiver.Export(apiv1.NewDiskCID("fake-disk-id"), "/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-tar-err"))
+		})
+	})
+
+	Describe("Import", func() {
+		const tarCmd = "tar --extract --gzip --no-same-owner --file /fake-archive.tgz --directory /fake-disks-dir/.import-fake-uuid"
+
+		unpacks := func(files map[string]string) {
+			cmdRunner.SetCmdCallback(tarCmd, func() {
+				for name, contents := range files {
+					err := fs.WriteFileString("/fake-disks-dir/.import-fake-uuid/"+name, contents)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+		}
+
+		It("moves unpacked disk image and metadata under new disk id", func() {
+			unpacks(map[string]string{"image": "fake-image", "image.json": `{"Props":{"ReadOnly":true}}`})
+
+			cid, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cid).To(Equal(apiv1.NewDiskCID("fake-uuid")))
+
+			Expect(fs.ReadFileString("/fake-disks-dir/fake-uuid")).To(Equal("fake-image"))
+			Expect(fs.ReadFileString("/fake-disks-dir/fake-uuid.json")).To(Equal(`{"Props":{"ReadOnly":true}}`))
+			Expect(fs.FileExists("/fake-disks-dir/.import-fake-uuid")).To(BeFalse())
+		})
+
+		It("imports disk image without metadata", func() {
+			unpacks(map[string]string{"image": "fake-image"})
+
+			_, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeTrue())
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid.json")).To(BeFalse())
+		})
+
+		It("returns error if archive does not contain disk image", func() {
+			unpacks(map[string]string{"other": "fake-other"})
+
+			_, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not contain disk image"))
+
+			Expect(fs.FileExists("/fake-disks-dir/.import-fake-uuid")).To(BeFalse())
+		})
+
+		It("returns error if disk image is not a regular file", func() {
+			cmdRunner.SetCmdCallback(tarCmd, func() {
+				err := fs.Symlink("/etc/shadow", "/fake-disks-dir/.import-fake-uuid/image")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			_, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("contains 'image' that is not a regular file"))
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+		})
+
+		It("returns error if metadata is not a regular file", func() {
+			cmdRunner.SetCmdCallback(tarCmd, func() {
+				err := fs.WriteFileString("/fake-disks-dir/.import-fake-uuid/image", "fake-image")
+				Expect(err).ToNot(HaveOccurred())
+
+				err = fs.Symlink("/etc/shadow", "/fake-disks-dir/.import-fake-uuid/image.json")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			_, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("contains 'image.json' that is not a regular file"))
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid.json")).To(BeFalse())
+		})
+
+		It("returns error if archived metadata is invalid", func() {
+			unpacks(map[string]string{"image": "fake-image", "image.json": "-"})
+
+			_, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unmarshalling disk metadata"))
+
+			Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+		})
+
+		DescribeTable("rejects archived metadata of disks that cannot be imported",
+			func(metadata, expectedErr string) {
+				unpacks(map[string]string{"image": "fake-image", "image.json": metadata})
+
+				_, err := archiver.Import("/fake-archive.tgz")
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(expectedErr))
+
+				Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+				Expect(fs.FileExists("/fake-disks-dir/fake-uuid.json")).To(BeFalse())
+			},
+			Entry("tmpfs disk", `{"Props":{"Type":"tmpfs"},"Size":40}`, "Importing tmpfs disks is not supported"),
+			Entry("directory disk", `{"Props":{"Type":"directory"}}`, "Importing directory disks is not supported"),
+			Entry("encrypted disk", `{"Props":{"Encrypted":true}}`, "Importing encrypted disks is not supported"),
+			Entry("negative size", `{"Props":{},"Size":-1}`, "Disk size '-1' must not be negative"),
+			Entry("unsupported filesystem", `{"Props":{"Filesystem":"btrfs"}}`, "Unsupported filesystem 'btrfs'"),
+		)
+
+		It("returns error if unpacking fails", func() {
+			cmdRunner.AddCmdResult(tarCmd, fakesys.FakeCmdResult{Error: errors.New("fake-tar-err")})
+
+			_, err := archiver.Import("/fake-archive.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-tar-err"))
+		})
+	})
+})
@@ -0,0 +1,168 @@
+package disk
+
+import (
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const (
+	CheckModeOff    = ""
+	CheckModeCheck  = "check"  // refuse to attach disks with filesystem errors
+	CheckModeRepair = "repair" // repair filesystem errors before attaching
+)
+
+// FSChecker runs fsck on disk images and logical volumes so that
+// dirty filesystems left behind by unclean host shutdowns are
+// reported or repaired instead of failing obscurely at mount time
+type FSChecker struct {
+	mode string
+
+	// Disks attached as block devices are partitioned by the agent
+	// hence do not contain a filesystem that could be checked
+	attachAsBlockDevices bool
+
+	cmdRunner boshsys.CmdRunner
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func NewFSChecker(
+	mode string,
+	attachAsBlockDevices bool,
+	cmdRunner boshsys.CmdRunner,
+	logger boshlog.Logger,
+) FSChecker {
+	return FSChecker{
+		mode:                 mode,
+		attachAsBlockDevices: attachAsBlockDevices,
+
+		cmdRunner: cmdRunner,
+
+		logTag: "disk.FSChecker",
+		logger: logger,
+	}
+}
+
+func (c FSChecker) Check(disk Disk) error {
+	switch disk.Props().Type {
+	case DiskTypeDirectory, DiskTypeTmpfs:
+		return nil
+	}
+
+	if c.mode == CheckModeOff || c.attachAsBlockDevices {
+		return nil
+	}
+
+	// Filesystem of encrypted disks is only reachable once attached
+	if disk.Props().Encrypted {
+		return nil
+	}
+
+	// Checking filesystem that is mounted (e.g. shared read-only disk)
+	// reports bogus errors and repairing it would corrupt it
+	if c.inUse(disk) {
+		c.logger.Debug(c.logTag, "Skipping check of disk '%s' since it is in use", disk.ID().AsString())
+		return nil
+	}
+
+	// Repairing is only attempted once read-only check found errors
+	// so that clean filesystems are never written to
+	report, err := c.checkReadOnly(disk)
+	if err == nil {
+		return nil
+	}
+
+	if c.mode != CheckModeRepair {
+		return c.checkErr(disk, report, err)
+	}
+
+	c.logger.Debug(c.logTag, "Repairing filesystem of disk '%s' since check found errors", disk.ID().AsString())
+
+	if disk.Props().filesystem() == FilesystemXFS {
+		return c.repairXFS(disk)
+	}
+
+	return c.repairExt4(disk)
+}
+
+func (c FSChecker) checkReadOnly(disk Disk) (string, error) {
+	if disk.Props().filesystem() == FilesystemXFS {
+		stdout, _, _, err := c.cmdRunner.RunCommand("xfs_repair", "-n", disk.Path())
+		return stdout, err
+	}
+
+	stdout, stderr, _, err := c.cmdRunner.RunCommand("e2fsck", "-n", disk.Path())
+	if err == nil || !c.needsJournalRecovery(stdout, stderr) {
+		return stdout, err
+	}
+
+	// Filesystem left behind by unclean shutdown only needs its journal
+	// replayed (as mounting would do) which read-only check does not do
+	c.logger.Debug(c.logTag, "Replaying journal of disk '%s' before checking it", disk.ID().AsString())
+
+	replayStdout, _, exitStatus, err := c.cmdRunner.RunCommand(
+		"e2fsck", "-p", "-E", "journal_only", disk.Path())
+
+	// 1 means that journal was replayed
+	if err != nil && exitStatus != 1 {
+		return replayStdout, bosherr.WrapErrorf(err, "Replaying journal of disk '%s'", disk.ID().AsString())
+	}
+
+	stdout, _, _, err = c.cmdRunner.RunCommand("e2fsck", "-n", disk.Path())
+
+	return stdout, err
+}
+
+func (c FSChecker) needsJournalRecovery(stdout, stderr string) bool {
+	const skippedRecovery = "skipping journal recovery"
+	return strings.Contains(stdout, skippedRecovery) || strings.Contains(stderr, skippedRecovery)
+}
+
+func (c FSChecker) repairExt4(disk Disk) error {
+	stdout, _, exitStatus, err := c.cmdRunner.RunCommand("e2fsck", "-f", "-y", disk.Path())
+
+	// 1 and 2 mean that errors were corrected
+	switch {
+	case err == nil:
+		return nil
+	case exitStatus == 1 || exitStatus == 2:
+		c.logger.Info(c.logTag, "Repaired filesystem of disk '%s':\n%s", disk.ID().AsString(), stdout)
+		return nil
+	default:
+		return bosherr.WrapErrorf(err, "Repairing filesystem of disk '%s'", disk.ID().AsString())
+	}
+}
+
+func (c FSChecker) repairXFS(disk Disk) error {
+	stdout, _, _, err := c.cmdRunner.RunCommand("xfs_repair", disk.Path())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Repairing filesystem of disk '%s'", disk.ID().AsString())
+	}
+
+	c.logger.Info(c.logTag, "Repaired filesystem of disk '%s':\n%s", disk.ID().AsString(), stdout)
+
+	return nil
+}
+
+func (c FSChecker) checkErr(disk Disk, report string, err error) error {
+	return bosherr.WrapErrorf(err,
+		"Filesystem of disk '%s' has errors; repair it or configure disk check mode to repair:\n%s",
+		disk.ID().AsString(), strings.TrimSpace(report))
+}
+
+func (c FSChecker) inUse(disk Disk) bool {
+	var stdout string
+	var err error
+
+	if disk.Props().Type == DiskTypeLVM {
+		stdout, _, _, err = c.cmdRunner.RunCommand("findmnt", "--noheadings", "--source", disk.Path())
+	} else {
+		stdout, _, _, err = c.cmdRunner.RunCommand("losetup", "--associated", disk.Path())
+	}
+
+	return err == nil && strings.TrimSpace(stdout) != ""
+}
@@ -0,0 +1,259 @@
+package disk_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/disk"
+	fakedisk "bosh-warden-cpi/disk/fakes"
+)
+
+var _ = Describe("FSChecker", func() {
+	var (
+		cmdRunner *fakesys.FakeCmdRunner
+		logger    boshlog.Logger
+		disk      *fakedisk.FakeDisk
+	)
+
+	BeforeEach(func() {
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		disk = fakedisk.NewFakeDiskWithPath(apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+	})
+
+	It("does not check disks when checks are off", func() {
+		err := NewFSChecker(CheckModeOff, false, cmdRunner, logger).Check(disk)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdRunner.RunCommands).To(BeEmpty())
+	})
+
+	It("does not check disks attached as block devices", func() {
+		err := NewFSChecker(CheckModeCheck, true, cmdRunner, logger).Check(disk)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdRunner.RunCommands).To(BeEmpty())
+	})
+
+	It("does not check directory disks", func() {
+		disk = fakedisk.NewFakeDiskWithProps(
+			apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", DiskProps{Type: DiskTypeDirectory})
+
+		err := NewFSChecker(CheckModeCheck, false, cmdRunner, logger).Check(disk)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdRunner.RunCommands).To(BeEmpty())
+	})
+
+	It("does not check disks that are in use", func() {
+		cmdRunner.AddCmdResult("losetup --associated /fake-disk-path", fakesys.FakeCmdResult{
+			Stdout: "/dev/loop3: [2049]:1234 (/fake-disk-path)\n",
+		})
+
+		err := NewFSChecker(CheckModeRepair, false, cmdRunner, logger).Check(disk)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdRunner.RunCommands).To(HaveLen(1))
+	})
+
+	Context("when checking", func() {
+		var checker FSChecker
+
+		BeforeEach(func() {
+			checker = NewFSChecker(CheckModeCheck, false, cmdRunner, logger)
+		})
+
+		It("runs read-only check of ext4 disk", func() {
+			err := checker.Check(disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"losetup", "--associated", "/fake-disk-path"},
+				{"e2fsck", "-n", "/fake-disk-path"},
+			}))
+		})
+
+		It("runs read-only check of xfs disk", func() {
+			disk = fakedisk.NewFakeDiskWithProps(
+				apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", DiskProps{Filesystem: FilesystemXFS})
+
+			err := checker.Check(disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands[1]).To(Equal([]string{"xfs_repair", "-n", "/fake-disk-path"}))
+		})
+
+		It("checks whether logical volumes are mounted", func() {
+			disk = fakedisk.NewFakeDiskWithProps(
+				apiv1.NewDiskCID("fake-disk-id"), "/dev/fake-vg/fake-lv", DiskProps{Type: DiskTypeLVM})
+
+			err := checker.Check(disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"findmnt", "--noheadings", "--source", "/dev/fake-vg/fake-lv"},
+				{"e2fsck", "-n", "/dev/fake-vg/fake-lv"},
+			}))
+		})
+
+		It("returns error with check report if filesystem has errors", func() {
+			cmdRunner.AddCmdResult("e2fsck -n /fake-disk-path", fakesys.FakeCmdResult{
+				Stdout:     "Inode 12 has illegal blocks.\n",
+				ExitStatus: 4,
+				Error:      errors.New("fake-fsck-err"),
+			})
+
+			err := checker.Check(disk)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Filesystem of disk 'fake-disk-id' has errors"))
+			Expect(err.Error()).To(ContainSubstring("Inode 12 has illegal blocks."))
+			Expect(err.Error()).To(ContainSubstring("fake-fsck-err"))
+		})
+
+		Context("when ext4 journal only needs recovery", func() {
+			BeforeEach(func() {
+				cmdRunner.AddCmdResult("e2fsck -n /fake-disk-path", fakesys.FakeCmdResult{
+					Stdout: "Warning: skipping journal recovery because doing a read-only filesystem check.\n" +
+						"/fake-disk-path: clean, 11/65536 files, 12955/262144 blocks\n",
+					ExitStatus: 4,
+					Error:      errors.New("fake-fsck-err"),
+				})
+			})
+
+			It("replays journal and accepts disk that is clean afterwards", func() {
+				cmdRunner.AddCmdResult("e2fsck -p -E journal_only /fake-disk-path", fakesys.FakeCmdResult{
+					ExitStatus: 1,
+					Error:      errors.New("fake-replay-err"),
+				})
+
+				err := checker.Check(disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					{"losetup", "--associated", "/fake-disk-path"},
+					{"e2fsck", "-n", "/fake-disk-path"},
+					{"e2fsck", "-p", "-E", "journal_only", "/fake-disk-path"},
+					{"e2fsck", "-n", "/fake-disk-path"},
+				}))
+			})
+
+			It("returns error if disk still has errors after replaying journal", func() {
+				cmdRunner.AddCmdResult("e2fsck -n /fake-disk-path", fakesys.FakeCmdResult{
+					Stdout:     "Inode 12 has illegal blocks.\n",
+					ExitStatus: 4,
+					Error:      errors.New("fake-fsck-err"),
+				})
+
+				err := checker.Check(disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Inode 12 has illegal blocks."))
+			})
+
+			It("returns error if replaying journal fails", func() {
+				cmdRunner.AddCmdResult("e2fsck -p -E journal_only /fake-disk-path", fakesys.FakeCmdResult{
+					ExitStatus: 8,
+					Error:      errors.New("fake-replay-err"),
+				})
+
+				err := checker.Check(disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Replaying journal of disk 'fake-disk-id'"))
+				Expect(err.Error()).To(ContainSubstring("fake-replay-err"))
+			})
+		})
+	})
+
+	Context("when repairing", func() {
+		var checker FSChecker
+
+		BeforeEach(func() {
+			checker = NewFSChecker(CheckModeRepair, false, cmdRunner, logger)
+		})
+
+		It("does not repair ext4 disk without errors", func() {
+			err := checker.Check(disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"losetup", "--associated", "/fake-disk-path"},
+				{"e2fsck", "-n", "/fake-disk-path"},
+			}))
+		})
+
+		Context("when read-only check finds errors", func() {
+			BeforeEach(func() {
+				cmdRunner.AddCmdResult("e2fsck -n /fake-disk-path", fakesys.FakeCmdResult{
+					Stdout:     "Inode 12 has illegal blocks.\n",
+					ExitStatus: 4,
+					Error:      errors.New("fake-fsck-err"),
+				})
+			})
+
+			It("repairs ext4 disk", func() {
+				err := checker.Check(disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					{"losetup", "--associated", "/fake-disk-path"},
+					{"e2fsck", "-n", "/fake-disk-path"},
+					{"e2fsck", "-f", "-y", "/fake-disk-path"},
+				}))
+			})
+
+			It("succeeds if errors were corrected", func() {
+				cmdRunner.AddCmdResult("e2fsck -f -y /fake-disk-path", fakesys.FakeCmdResult{
+					Stdout:     "FILE SYSTEM WAS MODIFIED\n",
+					ExitStatus: 1,
+					Error:      errors.New("fake-repair-err"),
+				})
+
+				err := checker.Check(disk)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns error if errors were left uncorrected", func() {
+				cmdRunner.AddCmdResult("e2fsck -f -y /fake-disk-path", fakesys.FakeCmdResult{
+					ExitStatus: 4,
+					Error:      errors.New("fake-repair-err"),
+				})
+
+				err := checker.Check(disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Repairing filesystem of disk 'fake-disk-id'"))
+				Expect(err.Error()).To(ContainSubstring("fake-repair-err"))
+			})
+		})
+
+		Context("when disk has xfs filesystem", func() {
+			BeforeEach(func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", DiskProps{Filesystem: FilesystemXFS})
+			})
+
+			It("does not repair xfs disk without errors", func() {
+				err := checker.Check(disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands[1:]).To(Equal([][]string{
+					{"xfs_repair", "-n", "/fake-disk-path"},
+				}))
+			})
+
+			It("repairs xfs disk if read-only check finds errors", func() {
+				cmdRunner.AddCmdResult("xfs_repair -n /fake-disk-path", fakesys.FakeCmdResult{
+					ExitStatus: 1,
+					Error:      errors.New("fake-xfs-check-err"),
+				})
+
+				err := checker.Check(disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands[1:]).To(Equal([][]string{
+					{"xfs_repair", "-n", "/fake-disk-path"},
+					{"xfs_repair", "/fake-disk-path"},
+				}))
+			})
+		})
+	})
+})
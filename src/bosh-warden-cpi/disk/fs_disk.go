@@ -8,8 +8,9 @@ import (
 )
 
 type FSDisk struct {
-	id   apiv1.DiskCID
-	path string
+	id    apiv1.DiskCID
+	path  string
+	props DiskProps
 
 	fs     boshsys.FileSystem
 	logger boshlog.Logger
@@ -18,16 +19,19 @@ type FSDisk struct {
 func NewFSDisk(
 	id apiv1.DiskCID,
 	path string,
+	props DiskProps,
 	fs boshsys.FileSystem,
 	logger boshlog.Logger,
 ) FSDisk {
-	return FSDisk{id: id, path: path, fs: fs, logger: logger}
+	return FSDisk{id: id, path: path, props: props, fs: fs, logger: logger}
 }
 
 func (s FSDisk) ID() apiv1.DiskCID { return s.id }
 
 func (s FSDisk) Path() string { return s.path }
 
+func (s FSDisk) Props() DiskProps { return s.props }
+
 func (s FSDisk) Exists() (bool, error) {
 	return s.fs.FileExists(s.path), nil
 }
@@ -38,5 +42,10 @@ func (s FSDisk) Delete() error {
 		return bosherr.WrapErrorf(err, "Deleting disk '%s'", s.path)
 	}
 
+	err = s.fs.RemoveAll(metadataPath(s.path))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting disk metadata '%s'", metadataPath(s.path))
+	}
+
 	return nil
 }
@@ -21,7 +21,7 @@ var _ = Describe("FSDisk", func() {
 	BeforeEach(func() {
 		fs = fakesys.NewFakeFileSystem()
 		logger := boshlog.NewLogger(boshlog.LevelNone)
-		disk = NewFSDisk(apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", fs, logger)
+		disk = NewFSDisk(apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", DiskProps{}, fs, logger)
 	})
 
 	Describe("Delete", func() {
@@ -35,6 +35,16 @@ var _ = Describe("FSDisk", func() {
 			Expect(fs.FileExists("/fake-disk-path")).To(BeFalse())
 		})
 
+		It("deletes recorded disk metadata", func() {
+			err := fs.WriteFileString("/fake-disk-path.json", "{}")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = disk.Delete()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-disk-path.json")).To(BeFalse())
+		})
+
 		It("returns error if deleting path fails", func() {
 			fs.RemoveAllStub = func(string) error {
 				return errors.New("fake-remove-all-err")
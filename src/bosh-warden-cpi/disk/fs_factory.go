@@ -3,6 +3,7 @@ package disk
 import (
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
@@ -14,6 +15,12 @@ import (
 type FSFactory struct {
 	dirPath string
 
+	// Used for disks that do not choose between sparse and preallocated images
+	preallocate bool
+
+	templates fsTemplates
+	luks      LUKS
+
 	fs        boshsys.FileSystem
 	uuidGen   boshuuid.Generator
 	cmdRunner boshsys.CmdRunner
@@ -24,13 +31,20 @@ type FSFactory struct {
 
 func NewFSFactory(
 	dirPath string,
+	templatesDirPath string,
+	preallocate bool,
+	encryptionKeyFilePath string,
 	fs boshsys.FileSystem,
 	uuidGen boshuuid.Generator,
 	cmdRunner boshsys.CmdRunner,
 	logger boshlog.Logger,
 ) FSFactory {
 	return FSFactory{
-		dirPath: dirPath,
+		dirPath:     dirPath,
+		preallocate: preallocate,
+
+		templates: newFSTemplates(templatesDirPath, fs, uuidGen, cmdRunner, logger),
+		luks:      NewLUKS(encryptionKeyFilePath, cmdRunner),
 
 		fs:        fs,
 		uuidGen:   uuidGen,
@@ -41,14 +55,22 @@ func NewFSFactory(
 	}
 }
 
-func (f FSFactory) Create(size int) (Disk, error) {
+func (f FSFactory) Create(size int, props DiskProps) (Disk, error) {
 	f.logger.Debug(f.logTag, "Creating disk of size '%d'", size)
 
+	if props.Encrypted && !f.luks.Enabled() {
+		return nil, bosherr.Error("Encrypted disks require disk encryption key file to be configured")
+	}
+
 	id, err := f.uuidGen.Generate()
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Generating disk id")
 	}
 
+	if props.Type == DiskTypeTmpfs {
+		return f.createTmpfs(id, size, props)
+	}
+
 	diskPath := filepath.Join(f.dirPath, id)
 
 	err = f.fs.WriteFile(diskPath, []byte{})
@@ -56,30 +78,159 @@ func (f FSFactory) Create(size int) (Disk, error) {
 		return nil, bosherr.WrapError(err, "Creating empty disk")
 	}
 
-	sizeStr := strconv.Itoa(size) + "M"
+	err = f.checkFreeSpace(size)
+	if err != nil {
+		f.cleanUpFile(diskPath)
+		return nil, err
+	}
 
-	_, _, _, err = f.cmdRunner.RunCommand("truncate", "-s", sizeStr, diskPath)
+	if props.Preallocate == nil {
+		props.Preallocate = &f.preallocate
+	}
+
+	err = f.buildDisk(diskPath, size, props)
 	if err != nil {
 		f.cleanUpFile(diskPath)
-		return nil, bosherr.WrapErrorf(err, "Resizing disk to '%s'", sizeStr)
+		return nil, err
 	}
 
-	_, _, _, err = f.cmdRunner.RunCommand("/sbin/mkfs", "-t", "ext4", "-F", diskPath)
+	err = saveMetadata(f.fs, diskPath, fsMetadata{Props: props})
 	if err != nil {
 		f.cleanUpFile(diskPath)
-		return nil, bosherr.WrapErrorf(err, "Building disk filesystem '%s'", diskPath)
+		return nil, err
 	}
 
-	return NewFSDisk(apiv1.NewDiskCID(id), diskPath, f.fs, f.logger), nil
+	return NewFSDisk(apiv1.NewDiskCID(id), diskPath, props, f.fs, f.logger), nil
 }
 
 func (f FSFactory) Find(id apiv1.DiskCID) (Disk, error) {
-	return NewFSDisk(id, filepath.Join(f.dirPath, id.AsString()), f.fs, f.logger), nil
+	diskPath := filepath.Join(f.dirPath, id.AsString())
+
+	metadata, err := loadMetadata(f.fs, diskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.Props.Type == DiskTypeTmpfs {
+		return f.newTmpfsDisk(id, diskPath, metadata.Props), nil
+	}
+
+	return NewFSDisk(id, diskPath, metadata.Props, f.fs, f.logger), nil
 }
 
-func (f FSFactory) cleanUpFile(path string) {
-	err := f.fs.RemoveAll(path)
+// buildDisk formats disk image of given size in MB either by
+// copying matching template or by running mkfs on an empty image
+func (f FSFactory) buildDisk(diskPath string, size int, props DiskProps) error {
+	// Copies of templates are sparse, hence preallocated disks are always formatted;
+	// encrypted disks must not share LUKS headers and keys with other disks
+	if *props.Preallocate || props.Encrypted || !f.templates.Enabled() {
+		return f.formatDisk(diskPath, size, props)
+	}
+
+	templatePath := f.templates.Path(size, props)
+
+	copied, err := f.templates.CopyTo(templatePath, diskPath, props)
+	if err != nil {
+		f.logger.Error(f.logTag, "Failed building disk from template, falling back to mkfs: %s", err.Error())
+	} else if copied {
+		return nil
+	}
+
+	err = f.formatDisk(diskPath, size, props)
+	if err != nil {
+		return err
+	}
+
+	f.templates.Save(diskPath, templatePath)
+
+	return nil
+}
+
+func (f FSFactory) formatDisk(diskPath string, size int, props DiskProps) error {
+	sizeStr := strconv.Itoa(size) + "M"
+
+	var err error
+
+	if *props.Preallocate {
+		// Allocating all blocks up front avoids running out of space on the host
+		// long after the disk was created when the store disk is overcommitted
+		_, _, _, err = f.cmdRunner.RunCommand("fallocate", "-l", sizeStr, diskPath)
+	} else {
+		_, _, _, err = f.cmdRunner.RunCommand("truncate", "-s", sizeStr, diskPath)
+	}
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Resizing disk to '%s'", sizeStr)
+	}
+
+	if props.Encrypted {
+		return f.formatEncryptedDisk(diskPath, props)
+	}
+
+	_, _, _, err = f.cmdRunner.RunCommand("/sbin/mkfs", props.mkfsArgs(diskPath)...)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Building disk filesystem '%s'", diskPath)
+	}
+
+	return nil
+}
+
+// formatEncryptedDisk builds filesystem inside of a new LUKS container
+func (f FSFactory) formatEncryptedDisk(diskPath string, props DiskProps) error {
+	err := f.luks.Format(diskPath)
 	if err != nil {
-		f.logger.Error(f.logTag, "Failed deleting file '%s': %s", path, err.Error())
+		return err
+	}
+
+	mappingName := "bwc-create-" + filepath.Base(diskPath)
+
+	device, err := f.luks.Open(diskPath, mappingName, false)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := f.luks.Close(mappingName)
+		if err != nil {
+			f.logger.Error(f.logTag, "Failed closing LUKS mapping '%s': %s", mappingName, err.Error())
+		}
+	}()
+
+	_, _, _, err = f.cmdRunner.RunCommand("/sbin/mkfs", props.mkfsArgs(device)...)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Building disk filesystem '%s'", device)
+	}
+
+	return nil
+}
+
+// checkFreeSpace fails when disks directory cannot back disk of given size in MB
+func (f FSFactory) checkFreeSpace(size int) error {
+	stdout, _, _, err := f.cmdRunner.RunCommand("df", "--output=avail", "-BM", f.dirPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking free space in '%s'", f.dirPath)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	availStr := strings.TrimSuffix(strings.TrimSpace(lines[len(lines)-1]), "M")
+
+	avail, err := strconv.Atoi(availStr)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Parsing free space in '%s'", f.dirPath)
+	}
+
+	if avail < size {
+		return bosherr.Errorf(
+			"Not enough free space in '%s' for disk of size '%dM': '%dM' available", f.dirPath, size, avail)
+	}
+
+	return nil
+}
+
+func (f FSFactory) cleanUpFile(path string) {
+	for _, p := range []string{path, metadataPath(path)} {
+		err := f.fs.RemoveAll(p)
+		if err != nil {
+			f.logger.Error(f.logTag, "Failed deleting file '%s': %s", p, err.Error())
+		}
 	}
 }
@@ -27,17 +27,24 @@ var _ = Describe("FSFactory", func() {
 		uuidGen = &fakeuuid.FakeGenerator{}
 		cmdRunner = fakesys.NewFakeCmdRunner()
 		logger = boshlog.NewLogger(boshlog.LevelNone)
-		factory = NewFSFactory("/fake-disks-dir", fs, uuidGen, cmdRunner, logger)
+		factory = NewFSFactory("/fake-disks-dir", "", false, "", fs, uuidGen, cmdRunner, logger)
+
+		cmdRunner.AddCmdResult("df --output=avail -BM /fake-disks-dir", fakesys.FakeCmdResult{
+			Stdout: " Avail\n1000M\n",
+		})
 	})
 
 	Describe("Create", func() {
 		It("returns unique disk id", func() {
 			uuidGen.GeneratedUUID = "fake-uuid"
 
-			disk, err := factory.Create(40)
+			disk, err := factory.Create(40, DiskProps{})
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedDisk := NewFSDisk(apiv1.NewDiskCID("fake-uuid"), "/fake-disks-dir/fake-uuid", fs, logger)
+			preallocate := false
+			expectedProps := DiskProps{Preallocate: &preallocate}
+
+			expectedDisk := NewFSDisk(apiv1.NewDiskCID("fake-uuid"), "/fake-disks-dir/fake-uuid", expectedProps, fs, logger)
 			Expect(disk).To(Equal(expectedDisk))
 		})
 
@@ -46,10 +53,39 @@ var _ = Describe("FSFactory", func() {
 				uuidGen.GeneratedUUID = "fake-uuid"
 			})
 
+			It("records disk properties next to the disk", func() {
+				disk, err := factory.Create(40, DiskProps{ReadOnly: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(disk.Props().ReadOnly).To(BeTrue())
+				Expect(*disk.Props().Preallocate).To(BeFalse())
+
+				contents, err := fs.ReadFileString("/fake-disks-dir/fake-uuid.json")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(MatchJSON(`{"Props":{
+					"Type":"",
+					"ReadOnly":true,
+					"Preallocate":false,
+					"Encrypted":false,
+					"Filesystem":"",
+					"FilesystemOpts":{"InodeRatio":0,"ReservedBlocksPercentage":null,"LazyInit":null}
+				}}`))
+			})
+
+			It("returns error and deletes disk if recording disk properties fails", func() {
+				fs.WriteFileErrors = map[string]error{"/fake-disks-dir/fake-uuid.json": errors.New("fake-write-err")}
+
+				disk, err := factory.Create(40, DiskProps{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-write-err"))
+				Expect(disk).To(BeNil())
+
+				Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+			})
+
 			It("touches disk path in disks directory", func() {
 				uuidGen.GeneratedUUID = "fake-uuid"
 
-				_, err := factory.Create(40)
+				_, err := factory.Create(40, DiskProps{})
 				Expect(err).ToNot(HaveOccurred())
 
 				bytes, err := fs.ReadFile("/fake-disks-dir/fake-uuid")
@@ -58,19 +94,94 @@ var _ = Describe("FSFactory", func() {
 			})
 
 			Context("when touching disk path succeeds", func() {
-				It("increases size of the file to given size in MB", func() {
-					_, err := factory.Create(40)
+				It("checks that disks directory has enough free space", func() {
+					_, err := factory.Create(40, DiskProps{})
 					Expect(err).ToNot(HaveOccurred())
 
-					Expect(len(cmdRunner.RunCommands)).To(BeNumerically(">", 0))
 					Expect(cmdRunner.RunCommands[0]).To(Equal(
+						[]string{"df", "--output=avail", "-BM", "/fake-disks-dir"},
+					))
+				})
+
+				It("returns error and deletes file if disks directory does not have enough free space", func() {
+					cmdRunner = fakesys.NewFakeCmdRunner()
+					cmdRunner.AddCmdResult("df --output=avail -BM /fake-disks-dir", fakesys.FakeCmdResult{
+						Stdout: " Avail\n  39M\n",
+					})
+					factory = NewFSFactory("/fake-disks-dir", "", false, "", fs, uuidGen, cmdRunner, logger)
+
+					disk, err := factory.Create(40, DiskProps{})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring(
+						"Not enough free space in '/fake-disks-dir' for disk of size '40M': '39M' available"))
+					Expect(disk).To(BeNil())
+
+					Expect(cmdRunner.RunCommands).To(HaveLen(1))
+					Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+				})
+
+				It("returns error if checking free space fails", func() {
+					cmdRunner = fakesys.NewFakeCmdRunner()
+					cmdRunner.AddCmdResult("df --output=avail -BM /fake-disks-dir", fakesys.FakeCmdResult{
+						Error: errors.New("fake-df-err"),
+					})
+					factory = NewFSFactory("/fake-disks-dir", "", false, "", fs, uuidGen, cmdRunner, logger)
+
+					disk, err := factory.Create(40, DiskProps{})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-df-err"))
+					Expect(disk).To(BeNil())
+				})
+
+				It("increases size of the file to given size in MB", func() {
+					_, err := factory.Create(40, DiskProps{})
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(len(cmdRunner.RunCommands)).To(BeNumerically(">", 1))
+					Expect(cmdRunner.RunCommands[1]).To(Equal(
+						[]string{"truncate", "-s", "40M", "/fake-disks-dir/fake-uuid"},
+					))
+				})
+
+				It("preallocates file of given size in MB if disk requests it", func() {
+					preallocate := true
+
+					disk, err := factory.Create(40, DiskProps{Preallocate: &preallocate})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(*disk.Props().Preallocate).To(BeTrue())
+
+					Expect(cmdRunner.RunCommands[1]).To(Equal(
+						[]string{"fallocate", "-l", "40M", "/fake-disks-dir/fake-uuid"},
+					))
+				})
+
+				It("preallocates file if disks are preallocated by default", func() {
+					factory = NewFSFactory("/fake-disks-dir", "", true, "", fs, uuidGen, cmdRunner, logger)
+
+					disk, err := factory.Create(40, DiskProps{})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(*disk.Props().Preallocate).To(BeTrue())
+
+					Expect(cmdRunner.RunCommands[1]).To(Equal(
+						[]string{"fallocate", "-l", "40M", "/fake-disks-dir/fake-uuid"},
+					))
+				})
+
+				It("makes sparse file if disk requests it even when disks are preallocated by default", func() {
+					factory = NewFSFactory("/fake-disks-dir", "", true, "", fs, uuidGen, cmdRunner, logger)
+					preallocate := false
+
+					_, err := factory.Create(40, DiskProps{Preallocate: &preallocate})
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(cmdRunner.RunCommands[1]).To(Equal(
 						[]string{"truncate", "-s", "40M", "/fake-disks-dir/fake-uuid"},
 					))
 				})
 
 				ItDestroysFile := func(errMsg string) {
 					It("deletes file since it was not turned into a filesystem", func() {
-						disk, err := factory.Create(40)
+						disk, err := factory.Create(40, DiskProps{})
 						Expect(err).To(HaveOccurred())
 						Expect(disk).To(BeNil())
 
@@ -85,7 +196,7 @@ var _ = Describe("FSFactory", func() {
 						})
 
 						It("returns running error and not destroy error", func() {
-							disk, err := factory.Create(40)
+							disk, err := factory.Create(40, DiskProps{})
 							Expect(err).To(HaveOccurred())
 							Expect(err.Error()).To(ContainSubstring(errMsg))
 							Expect(disk).To(BeNil())
@@ -95,15 +206,47 @@ var _ = Describe("FSFactory", func() {
 
 				Context("when increasing file size succeeds", func() {
 					It("turns file into a filesystem", func() {
-						_, err := factory.Create(40)
+						_, err := factory.Create(40, DiskProps{})
 						Expect(err).ToNot(HaveOccurred())
 
-						Expect(cmdRunner.RunCommands).To(HaveLen(2))
-						Expect(cmdRunner.RunCommands[1]).To(Equal(
+						Expect(cmdRunner.RunCommands).To(HaveLen(3))
+						Expect(cmdRunner.RunCommands[2]).To(Equal(
 							[]string{"/sbin/mkfs", "-t", "ext4", "-F", "/fake-disks-dir/fake-uuid"},
 						))
 					})
 
+					It("formats file with requested filesystem", func() {
+						_, err := factory.Create(40, DiskProps{Filesystem: "xfs"})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands[2]).To(Equal(
+							[]string{"/sbin/mkfs", "-t", "xfs", "-f", "/fake-disks-dir/fake-uuid"},
+						))
+					})
+
+					It("formats file with requested ext4 options", func() {
+						reserved := 0
+						lazy := false
+
+						_, err := factory.Create(40, DiskProps{
+							Filesystem: "ext4",
+							FilesystemOpts: FilesystemOpts{
+								InodeRatio:               65536,
+								ReservedBlocksPercentage: &reserved,
+								LazyInit:                 &lazy,
+							},
+						})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands[2]).To(Equal([]string{
+							"/sbin/mkfs", "-t", "ext4", "-F",
+							"-i", "65536",
+							"-m", "0",
+							"-E", "lazy_itable_init=0,lazy_journal_init=0",
+							"/fake-disks-dir/fake-uuid",
+						}))
+					})
+
 					Context("when turning file into a filesystem fails", func() {
 						BeforeEach(func() {
 							cmdRunner.AddCmdResult(
@@ -113,7 +256,7 @@ var _ = Describe("FSFactory", func() {
 						})
 
 						It("returns an error", func() {
-							disk, err := factory.Create(40)
+							disk, err := factory.Create(40, DiskProps{})
 							Expect(err).To(HaveOccurred())
 							Expect(err.Error()).To(ContainSubstring("fake-run-err"))
 							Expect(disk).To(BeNil())
@@ -132,7 +275,7 @@ var _ = Describe("FSFactory", func() {
 					})
 
 					It("returns an error", func() {
-						disk, err := factory.Create(40)
+						disk, err := factory.Create(40, DiskProps{})
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("fake-run-err"))
 						Expect(disk).To(BeNil())
@@ -142,11 +285,284 @@ var _ = Describe("FSFactory", func() {
 				})
 			})
 
+			Context("when disk is a tmpfs", func() {
+				It("mounts size limited tmpfs at disk directory and records its size", func() {
+					disk, err := factory.Create(40, DiskProps{Type: DiskTypeTmpfs})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(disk.Path()).To(Equal("/fake-disks-dir/fake-uuid"))
+					Expect(disk.Props().Type).To(Equal(DiskTypeTmpfs))
+
+					pathStat := fs.GetFileTestStat("/fake-disks-dir/fake-uuid")
+					Expect(pathStat.FileType).To(Equal(fakesys.FakeFileTypeDir))
+
+					Expect(cmdRunner.RunCommands).To(Equal([][]string{
+						{"mount", "-t", "tmpfs", "-o", "size=40m,mode=0755", "tmpfs", "/fake-disks-dir/fake-uuid"},
+					}))
+
+					contents, err := fs.ReadFileString("/fake-disks-dir/fake-uuid.json")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(contents).To(ContainSubstring(`"Size":40`))
+				})
+
+				It("returns error and deletes disk directory if mounting tmpfs fails", func() {
+					cmdRunner.AddCmdResult(
+						"mount -t tmpfs -o size=40m,mode=0755 tmpfs /fake-disks-dir/fake-uuid",
+						fakesys.FakeCmdResult{Error: errors.New("fake-mount-err")},
+					)
+
+					disk, err := factory.Create(40, DiskProps{Type: DiskTypeTmpfs})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-mount-err"))
+					Expect(disk).To(BeNil())
+
+					Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+				})
+
+				Describe("Exists", func() {
+					const findmntCmd = "findmnt --noheadings --output FSTYPE --mountpoint /fake-disks-dir/fake-uuid"
+
+					BeforeEach(func() {
+						_, err := factory.Create(40, DiskProps{Type: DiskTypeTmpfs})
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					It("returns true if tmpfs is mounted at disk directory", func() {
+						cmdRunner.AddCmdResult(findmntCmd, fakesys.FakeCmdResult{Stdout: "tmpfs\n"})
+
+						disk, err := factory.Find(apiv1.NewDiskCID("fake-uuid"))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(disk.Exists()).To(BeTrue())
+					})
+
+					It("returns false if disk directory is not a mount point", func() {
+						cmdRunner.AddCmdResult(findmntCmd, fakesys.FakeCmdResult{
+							ExitStatus: 1,
+							Error:      errors.New("fake-findmnt-err"),
+						})
+
+						disk, err := factory.Find(apiv1.NewDiskCID("fake-uuid"))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(disk.Exists()).To(BeFalse())
+					})
+
+					It("returns false if something else than tmpfs is mounted at disk directory", func() {
+						cmdRunner.AddCmdResult(findmntCmd, fakesys.FakeCmdResult{Stdout: "ext4\n"})
+
+						disk, err := factory.Find(apiv1.NewDiskCID("fake-uuid"))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(disk.Exists()).To(BeFalse())
+					})
+
+					It("returns error if checking mount fails", func() {
+						cmdRunner.AddCmdResult(findmntCmd, fakesys.FakeCmdResult{
+							ExitStatus: 2,
+							Error:      errors.New("fake-findmnt-err"),
+						})
+
+						disk, err := factory.Find(apiv1.NewDiskCID("fake-uuid"))
+						Expect(err).ToNot(HaveOccurred())
+
+						_, err = disk.Exists()
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("fake-findmnt-err"))
+					})
+				})
+
+				It("unmounts tmpfs and deletes disk directory when disk is deleted", func() {
+					_, err := factory.Create(40, DiskProps{Type: DiskTypeTmpfs})
+					Expect(err).ToNot(HaveOccurred())
+
+					disk, err := factory.Find(apiv1.NewDiskCID("fake-uuid"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(disk.Props().Type).To(Equal(DiskTypeTmpfs))
+
+					err = disk.Delete()
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(cmdRunner.RunCommands[1]).To(Equal([]string{"umount", "/fake-disks-dir/fake-uuid"}))
+					Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+					Expect(fs.FileExists("/fake-disks-dir/fake-uuid.json")).To(BeFalse())
+				})
+			})
+
+			Context("when disk is encrypted", func() {
+				BeforeEach(func() {
+					factory = NewFSFactory("/fake-disks-dir", "/fake-templates-dir", false, "/fake-key-file", fs, uuidGen, cmdRunner, logger)
+				})
+
+				It("formats filesystem inside of LUKS container and closes it", func() {
+					disk, err := factory.Create(40, DiskProps{Encrypted: true})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(disk.Props().Encrypted).To(BeTrue())
+
+					Expect(cmdRunner.RunCommands[1:]).To(Equal([][]string{
+						{"truncate", "-s", "40M", "/fake-disks-dir/fake-uuid"},
+						{"cryptsetup", "luksFormat", "--batch-mode", "--type", "luks2", "--key-file", "/fake-key-file", "/fake-disks-dir/fake-uuid"},
+						{"cryptsetup", "open", "--type", "luks", "--key-file", "/fake-key-file", "/fake-disks-dir/fake-uuid", "bwc-create-fake-uuid"},
+						{"/sbin/mkfs", "-t", "ext4", "-F", "/dev/mapper/bwc-create-fake-uuid"},
+						{"cryptsetup", "status", "bwc-create-fake-uuid"},
+						{"cryptsetup", "close", "bwc-create-fake-uuid"},
+					}))
+				})
+
+				It("closes LUKS container and deletes disk if building filesystem fails", func() {
+					cmdRunner.AddCmdResult("/sbin/mkfs -t ext4 -F /dev/mapper/bwc-create-fake-uuid", fakesys.FakeCmdResult{
+						Error: errors.New("fake-mkfs-err"),
+					})
+
+					disk, err := factory.Create(40, DiskProps{Encrypted: true})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-mkfs-err"))
+					Expect(disk).To(BeNil())
+
+					Expect(cmdRunner.RunCommands[len(cmdRunner.RunCommands)-1]).To(Equal(
+						[]string{"cryptsetup", "close", "bwc-create-fake-uuid"}))
+					Expect(fs.FileExists("/fake-disks-dir/fake-uuid")).To(BeFalse())
+				})
+
+				It("returns error if setting up LUKS container fails", func() {
+					cmdRunner.AddCmdResult(
+						"cryptsetup luksFormat --batch-mode --type luks2 --key-file /fake-key-file /fake-disks-dir/fake-uuid",
+						fakesys.FakeCmdResult{Error: errors.New("fake-luks-err")},
+					)
+
+					_, err := factory.Create(40, DiskProps{Encrypted: true})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-luks-err"))
+				})
+
+				It("returns error if encryption key file is not configured", func() {
+					factory = NewFSFactory("/fake-disks-dir", "", false, "", fs, uuidGen, cmdRunner, logger)
+
+					_, err := factory.Create(40, DiskProps{Encrypted: true})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("Encrypted disks require disk encryption key file to be configured"))
+					Expect(cmdRunner.RunCommands).To(BeEmpty())
+				})
+			})
+
+			Context("when disk templates are enabled", func() {
+				const templatePath = "/fake-templates-dir/ext4-40M-28fba2c2c313"
+
+				BeforeEach(func() {
+					factory = NewFSFactory("/fake-disks-dir", "/fake-templates-dir", false, "", fs, uuidGen, cmdRunner, logger)
+				})
+
+				Context("when matching template exists", func() {
+					BeforeEach(func() {
+						err := fs.WriteFile(templatePath, []byte{})
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					It("copies template instead of running mkfs and gives copy new filesystem UUID", func() {
+						disk, err := factory.Create(40, DiskProps{})
+						Expect(err).ToNot(HaveOccurred())
+						Expect(disk.Path()).To(Equal("/fake-disks-dir/fake-uuid"))
+
+						Expect(cmdRunner.RunCommands).To(Equal([][]string{
+							{"df", "--output=avail", "-BM", "/fake-disks-dir"},
+							{"cp", "--reflink=auto", "--sparse=always", templatePath, "/fake-disks-dir/fake-uuid"},
+							{"tune2fs", "-U", "random", "/fake-disks-dir/fake-uuid"},
+						}))
+					})
+
+					It("regenerates UUID with xfs_admin for xfs disks", func() {
+						err := fs.WriteFile("/fake-templates-dir/xfs-40M-4f767aedbd20", []byte{})
+						Expect(err).ToNot(HaveOccurred())
+
+						_, err = factory.Create(40, DiskProps{Filesystem: "xfs"})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands[2]).To(Equal(
+							[]string{"xfs_admin", "-U", "generate", "/fake-disks-dir/fake-uuid"},
+						))
+					})
+
+					It("falls back to mkfs if copying template fails", func() {
+						cmdRunner.AddCmdResult(
+							"cp --reflink=auto --sparse=always "+templatePath+" /fake-disks-dir/fake-uuid",
+							fakesys.FakeCmdResult{Error: errors.New("fake-cp-err")},
+						)
+
+						_, err := factory.Create(40, DiskProps{})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands[2]).To(Equal(
+							[]string{"truncate", "-s", "40M", "/fake-disks-dir/fake-uuid"},
+						))
+						Expect(cmdRunner.RunCommands[3]).To(Equal(
+							[]string{"/sbin/mkfs", "-t", "ext4", "-F", "/fake-disks-dir/fake-uuid"},
+						))
+					})
+
+					It("runs mkfs for preallocated disks since template copies are sparse", func() {
+						preallocate := true
+
+						_, err := factory.Create(40, DiskProps{Preallocate: &preallocate})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands).To(HaveLen(3))
+						Expect(cmdRunner.RunCommands[1][0]).To(Equal("fallocate"))
+						Expect(cmdRunner.RunCommands[2][0]).To(Equal("/sbin/mkfs"))
+					})
+				})
+
+				Context("when matching template does not exist", func() {
+					const tmpTemplatePath = templatePath + ".fake-uuid.tmp"
+
+					BeforeEach(func() {
+						cmdRunner.SetCmdCallback(
+							"cp --reflink=auto --sparse=always /fake-disks-dir/fake-uuid "+tmpTemplatePath,
+							func() {
+								err := fs.WriteFile(tmpTemplatePath, []byte{})
+								Expect(err).ToNot(HaveOccurred())
+							},
+						)
+					})
+
+					It("formats disk and saves it as a template via temporary file", func() {
+						_, err := factory.Create(40, DiskProps{})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands[2][0]).To(Equal("/sbin/mkfs"))
+						Expect(cmdRunner.RunCommands[3]).To(Equal([]string{
+							"cp", "--reflink=auto", "--sparse=always", "/fake-disks-dir/fake-uuid", tmpTemplatePath,
+						}))
+
+						Expect(fs.FileExists(templatePath)).To(BeTrue())
+						Expect(fs.FileExists(tmpTemplatePath)).To(BeFalse())
+					})
+
+					It("creates disk and deletes temporary file if saving template fails", func() {
+						fs.RenameError = errors.New("fake-rename-err")
+
+						disk, err := factory.Create(40, DiskProps{})
+						Expect(err).ToNot(HaveOccurred())
+						Expect(disk).ToNot(BeNil())
+
+						Expect(fs.FileExists(templatePath)).To(BeFalse())
+						Expect(fs.FileExists(tmpTemplatePath)).To(BeFalse())
+					})
+
+					It("uses separate templates for different filesystem options", func() {
+						reserved := 0
+
+						_, err := factory.Create(40, DiskProps{
+							FilesystemOpts: FilesystemOpts{ReservedBlocksPercentage: &reserved},
+						})
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(cmdRunner.RunCommands[3][4]).ToNot(Equal(tmpTemplatePath))
+						Expect(cmdRunner.RunCommands[3][4]).To(HavePrefix("/fake-templates-dir/ext4-40M-"))
+					})
+				})
+			})
+
 			Context("when touching disk path fails", func() {
 				It("returns error if touching disk path fails", func() {
 					fs.WriteFileError = errors.New("fake-write-file-err")
 
-					disk, err := factory.Create(40)
+					disk, err := factory.Create(40, DiskProps{})
 					Expect(err).To(HaveOccurred())
 					Expect(err.Error()).To(ContainSubstring("fake-write-file-err"))
 					Expect(disk).To(BeNil())
@@ -158,7 +574,7 @@ var _ = Describe("FSFactory", func() {
 			It("returns error if generating disk id fails", func() {
 				uuidGen.GenerateError = errors.New("fake-generate-err")
 
-				disk, err := factory.Create(40)
+				disk, err := factory.Create(40, DiskProps{})
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("fake-generate-err"))
 				Expect(disk).To(BeNil())
@@ -173,7 +589,25 @@ var _ = Describe("FSFactory", func() {
 
 			disk, err := factory.Find(apiv1.NewDiskCID("fake-disk-id"))
 			Expect(err).ToNot(HaveOccurred())
-			Expect(disk).To(Equal(NewFSDisk(apiv1.NewDiskCID("fake-disk-id"), "/fake-disks-dir/fake-disk-id", fs, logger)))
+			Expect(disk).To(Equal(NewFSDisk(apiv1.NewDiskCID("fake-disk-id"), "/fake-disks-dir/fake-disk-id", DiskProps{}, fs, logger)))
+		})
+
+		It("returns disk with recorded properties", func() {
+			err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", `{"Props":{"ReadOnly":true}}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			disk, err := factory.Find(apiv1.NewDiskCID("fake-disk-id"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disk.Props()).To(Equal(DiskProps{ReadOnly: true}))
+		})
+
+		It("returns error if recorded properties cannot be read", func() {
+			err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", "-")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = factory.Find(apiv1.NewDiskCID("fake-disk-id"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unmarshalling disk metadata"))
 		})
 	})
 })
@@ -0,0 +1,59 @@
+package disk
+
+import (
+	"encoding/json"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// fsMetadata is recorded next to each disk image so that properties
+// chosen at create_disk time are known when the disk is later attached
+type fsMetadata struct {
+	Props DiskProps
+
+	// Size in MB requested at create_disk time
+	Size int `json:",omitempty"`
+
+	// Project quota ID of directory disks
+	ProjectID uint32 `json:",omitempty"`
+}
+
+func metadataPath(diskPath string) string {
+	return diskPath + ".json"
+}
+
+func saveMetadata(fs boshsys.FileSystem, diskPath string, metadata fsMetadata) error {
+	bytes, err := json.Marshal(metadata)
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling disk metadata")
+	}
+
+	err = fs.WriteFile(metadataPath(diskPath), bytes)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing disk metadata '%s'", metadataPath(diskPath))
+	}
+
+	return nil
+}
+
+// loadMetadata returns empty metadata for disks created before metadata was recorded
+func loadMetadata(fs boshsys.FileSystem, diskPath string) (fsMetadata, error) {
+	var metadata fsMetadata
+
+	if !fs.FileExists(metadataPath(diskPath)) {
+		return metadata, nil
+	}
+
+	bytes, err := fs.ReadFile(metadataPath(diskPath))
+	if err != nil {
+		return metadata, bosherr.WrapErrorf(err, "Reading disk metadata '%s'", metadataPath(diskPath))
+	}
+
+	err = json.Unmarshal(bytes, &metadata)
+	if err != nil {
+		return metadata, bosherr.WrapErrorf(err, "Unmarshalling disk metadata '%s'", metadataPath(diskPath))
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,114 @@
+package disk
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+)
+
+// fsTemplates caches blank formatted disk images so that new disks
+// can be copied from them instead of running mkfs every time.
+// Templates are published with a rename so that concurrent
+// CPI processes never observe partially written templates.
+type fsTemplates struct {
+	dirPath string
+
+	fs        boshsys.FileSystem
+	uuidGen   boshuuid.Generator
+	cmdRunner boshsys.CmdRunner
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func newFSTemplates(
+	dirPath string,
+	fs boshsys.FileSystem,
+	uuidGen boshuuid.Generator,
+	cmdRunner boshsys.CmdRunner,
+	logger boshlog.Logger,
+) fsTemplates {
+	return fsTemplates{
+		dirPath: dirPath,
+
+		fs:        fs,
+		uuidGen:   uuidGen,
+		cmdRunner: cmdRunner,
+
+		logTag: "disk.fsTemplates",
+		logger: logger,
+	}
+}
+
+func (t fsTemplates) Enabled() bool { return t.dirPath != "" }
+
+// Path returns template location for disks of given size and filesystem options
+func (t fsTemplates) Path(size int, props DiskProps) string {
+	optsSum := sha1.Sum([]byte(strings.Join(props.mkfsArgs(""), " ")))
+	name := fmt.Sprintf("%s-%dM-%x", props.filesystem(), size, optsSum[:6])
+	return filepath.Join(t.dirPath, name)
+}
+
+// CopyTo copies existing template onto disk path and gives
+// the copy its own filesystem UUID. Returns false if there is no template.
+func (t fsTemplates) CopyTo(templatePath, diskPath string, props DiskProps) (bool, error) {
+	if !t.fs.FileExists(templatePath) {
+		return false, nil
+	}
+
+	_, _, _, err := t.cmdRunner.RunCommand(
+		"cp", "--reflink=auto", "--sparse=always", templatePath, diskPath)
+	if err != nil {
+		return false, bosherr.WrapErrorf(err, "Copying disk template '%s'", templatePath)
+	}
+
+	if props.filesystem() == FilesystemXFS {
+		_, _, _, err = t.cmdRunner.RunCommand("xfs_admin", "-U", "generate", diskPath)
+	} else {
+		_, _, _, err = t.cmdRunner.RunCommand("tune2fs", "-U", "random", diskPath)
+	}
+	if err != nil {
+		return false, bosherr.WrapErrorf(err, "Regenerating filesystem UUID of '%s'", diskPath)
+	}
+
+	return true, nil
+}
+
+// Save publishes freshly formatted disk as a template.
+// Failures are only logged since templates are just an optimization.
+func (t fsTemplates) Save(diskPath, templatePath string) {
+	err := t.fs.MkdirAll(t.dirPath, os.FileMode(0755))
+	if err != nil {
+		t.logger.Error(t.logTag, "Failed making disk templates dir: %s", err.Error())
+		return
+	}
+
+	suffix, err := t.uuidGen.Generate()
+	if err != nil {
+		t.logger.Error(t.logTag, "Failed generating disk template name: %s", err.Error())
+		return
+	}
+
+	tmpPath := templatePath + "." + suffix + ".tmp"
+
+	_, _, _, err = t.cmdRunner.RunCommand(
+		"cp", "--reflink=auto", "--sparse=always", diskPath, tmpPath)
+	if err == nil {
+		err = t.fs.Rename(tmpPath, templatePath)
+	}
+	if err != nil {
+		t.logger.Error(t.logTag, "Failed saving disk template '%s': %s", templatePath, err.Error())
+
+		removeErr := t.fs.RemoveAll(tmpPath)
+		if removeErr != nil {
+			t.logger.Error(t.logTag, "Failed deleting '%s': %s", tmpPath, removeErr.Error())
+		}
+	}
+}
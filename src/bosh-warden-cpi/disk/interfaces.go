@@ -5,7 +5,7 @@ import (
 )
 
 type Creator interface {
-	Create(size int) (Disk, error)
+	Create(size int, props DiskProps) (Disk, error)
 }
 
 type Finder interface {
@@ -15,7 +15,54 @@ type Finder interface {
 type Disk interface {
 	ID() apiv1.DiskCID
 	Path() string
+	Props() DiskProps
 
 	Exists() (bool, error)
 	Delete() error
 }
+
+// Checker verifies disk filesystem before disk is attached
+type Checker interface {
+	Check(Disk) error
+}
+
+// Resizer is implemented by disks whose backend can grow them
+type Resizer interface {
+	Resize(size int) error
+}
+
+// Snapshotter is implemented by disks whose backend can snapshot them
+type Snapshotter interface {
+	Snapshot() (apiv1.SnapshotCID, error)
+}
+
+// SnapshotDeleter is implemented by factories of disks that are Snapshotters
+type SnapshotDeleter interface {
+	DeleteSnapshot(apiv1.SnapshotCID) error
+}
+
+const (
+	DiskTypeImage     = "image"     // filesystem image attached via loop device
+	DiskTypeDirectory = "directory" // plain directory bind mounted into VMs
+	DiskTypeLVM       = "lvm"       // thin logical volume mounted as block device
+	DiskTypeTmpfs     = "tmpfs"     // size limited tmpfs bind mounted into VMs
+)
+
+type DiskProps struct {
+	// e.g. image, directory, lvm, tmpfs; disks recorded without it are images
+	Type string
+
+	// Read-only disks are mounted read-only and may be attached to several VMs
+	ReadOnly bool
+
+	// Allocate all blocks of the disk image instead of making a sparse file;
+	// nil means disk backend's default
+	Preallocate *bool
+
+	// Filesystem is kept in a LUKS container opened with configured key file
+	Encrypted bool
+
+	// e.g. ext4, xfs; disks recorded without it are ext4
+	Filesystem     string
+	FilesystemOpts FilesystemOpts
+}
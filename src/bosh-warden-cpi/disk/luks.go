@@ -0,0 +1,69 @@
+package disk
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// LUKS manages dm-crypt containers of encrypted disks;
+// all containers are protected by the same key file
+type LUKS struct {
+	keyFilePath string
+	cmdRunner   boshsys.CmdRunner
+}
+
+func NewLUKS(keyFilePath string, cmdRunner boshsys.CmdRunner) LUKS {
+	return LUKS{keyFilePath: keyFilePath, cmdRunner: cmdRunner}
+}
+
+func (l LUKS) Enabled() bool { return l.keyFilePath != "" }
+
+// Format sets up LUKS container on disk image or device at given path
+func (l LUKS) Format(path string) error {
+	if !l.Enabled() {
+		return bosherr.Error("Encrypted disks require disk encryption key file to be configured")
+	}
+
+	_, _, _, err := l.cmdRunner.RunCommand(
+		"cryptsetup", "luksFormat", "--batch-mode", "--type", "luks2", "--key-file", l.keyFilePath, path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Formatting LUKS container on '%s'", path)
+	}
+
+	return nil
+}
+
+// Open maps LUKS container at given path and returns mapped device path
+func (l LUKS) Open(path, name string, readOnly bool) (string, error) {
+	if !l.Enabled() {
+		return "", bosherr.Error("Encrypted disks require disk encryption key file to be configured")
+	}
+
+	args := []string{"open", "--type", "luks", "--key-file", l.keyFilePath}
+	if readOnly {
+		args = append(args, "--readonly")
+	}
+
+	_, _, _, err := l.cmdRunner.RunCommand("cryptsetup", append(args, path, name)...)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Opening LUKS container on '%s'", path)
+	}
+
+	return "/dev/mapper/" + name, nil
+}
+
+// Close removes mapping with given name if it exists
+func (l LUKS) Close(name string) error {
+	// status exits with non-zero code for inactive mappings
+	_, _, _, err := l.cmdRunner.RunCommand("cryptsetup", "status", name)
+	if err != nil {
+		return nil
+	}
+
+	_, _, _, err = l.cmdRunner.RunCommand("cryptsetup", "close", name)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Closing LUKS mapping '%s'", name)
+	}
+
+	return nil
+}
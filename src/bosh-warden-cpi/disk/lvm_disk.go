@@ -0,0 +1,155 @@
+package disk
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+)
+
+// LVMDisk is a persistent disk backed by a thin logical volume
+type LVMDisk struct {
+	id          apiv1.DiskCID
+	volumeGroup string
+	props       DiskProps
+	size        int
+
+	// Disk metadata is recorded at this path with .json extension
+	metadataBasePath string
+
+	fs        boshsys.FileSystem
+	uuidGen   boshuuid.Generator
+	cmdRunner boshsys.CmdRunner
+	logger    boshlog.Logger
+}
+
+func (s LVMDisk) ID() apiv1.DiskCID { return s.id }
+
+func (s LVMDisk) Path() string { return "/dev/" + s.volumeGroup + "/" + s.volumeName() }
+
+func (s LVMDisk) Props() DiskProps { return s.props }
+
+func (s LVMDisk) Exists() (bool, error) {
+	stdout, _, _, err := s.cmdRunner.RunCommand(
+		"lvs", "--noheadings", "--options", "lv_name", s.volumeGroup)
+	if err != nil {
+		return false, bosherr.WrapErrorf(err, "Listing volumes in '%s'", s.volumeGroup)
+	}
+
+	for _, name := range strings.Fields(stdout) {
+		if name == s.volumeName() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s LVMDisk) Delete() error {
+	found, err := s.Exists()
+	if err != nil {
+		return err
+	}
+
+	if found {
+		_, _, _, err = s.cmdRunner.RunCommand("lvremove", "--yes", s.volume())
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Removing thin volume '%s'", s.volume())
+		}
+	}
+
+	err = s.fs.RemoveAll(metadataPath(s.metadataBasePath))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting disk metadata '%s'", metadataPath(s.metadataBasePath))
+	}
+
+	return nil
+}
+
+// Resize grows thin volume and its filesystem to given size in MB.
+// Disk must not be attached since only ext4 can be grown offline.
+func (s LVMDisk) Resize(size int) error {
+	inUse, err := s.inUse()
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return bosherr.Errorf("Disk '%s' is in use; detach it before resizing", s.id.AsString())
+	}
+
+	if size < s.size {
+		return bosherr.Errorf("Shrinking disk '%s' from '%dM' to '%dM' is not supported", s.id.AsString(), s.size, size)
+	}
+
+	if size == s.size {
+		return nil
+	}
+
+	if s.props.filesystem() != FilesystemExt4 {
+		return bosherr.Errorf("Resizing '%s' disks is not supported", s.props.filesystem())
+	}
+
+	_, _, _, err = s.cmdRunner.RunCommand("lvextend", "--size", strconv.Itoa(size)+"M", s.volume())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Extending thin volume '%s'", s.volume())
+	}
+
+	// resize2fs refuses to grow filesystems that were not recently checked
+	_, _, _, err = s.cmdRunner.RunCommand("e2fsck", "-f", "-p", s.Path())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking disk filesystem '%s'", s.Path())
+	}
+
+	_, _, _, err = s.cmdRunner.RunCommand("resize2fs", s.Path())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Resizing disk filesystem '%s'", s.Path())
+	}
+
+	s.size = size
+
+	return saveMetadata(s.fs, s.metadataBasePath, fsMetadata{Props: s.props, Size: s.size})
+}
+
+// inUse tells whether volume is mounted or held open, e.g. by loop device
+// or by filesystem mounted inside container from bind mounted device node
+func (s LVMDisk) inUse() (bool, error) {
+	stdout, _, _, err := s.cmdRunner.RunCommand("findmnt", "--noheadings", "--source", s.Path())
+	if err == nil && strings.TrimSpace(stdout) != "" {
+		return true, nil
+	}
+
+	stdout, _, _, err = s.cmdRunner.RunCommand("lvs", "--noheadings", "--options", "lv_attr", s.volume())
+	if err != nil {
+		return false, bosherr.WrapErrorf(err, "Checking whether thin volume '%s' is open", s.volume())
+	}
+
+	// Sixth lv_attr character is 'o' for open volumes
+	attr := strings.TrimSpace(stdout)
+
+	return len(attr) > 5 && attr[5] == 'o', nil
+}
+
+// Snapshot makes thin snapshot which shares blocks with the disk
+func (s LVMDisk) Snapshot() (apiv1.SnapshotCID, error) {
+	id, err := s.uuidGen.Generate()
+	if err != nil {
+		return apiv1.SnapshotCID{}, bosherr.WrapError(err, "Generating snapshot id")
+	}
+
+	_, _, _, err = s.cmdRunner.RunCommand(
+		"lvcreate", "--snapshot", "--name", lvmSnapshotPrefix+id, s.volume())
+	if err != nil {
+		return apiv1.SnapshotCID{}, bosherr.WrapErrorf(err, "Snapshotting thin volume '%s'", s.volume())
+	}
+
+	return apiv1.NewSnapshotCID(id), nil
+}
+
+func (s LVMDisk) volumeName() string { return lvmDiskPrefix + s.id.AsString() }
+
+func (s LVMDisk) volume() string { return s.volumeGroup + "/" + s.volumeName() }
@@ -0,0 +1,146 @@
+package disk
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+)
+
+const (
+	lvmDiskPrefix     = "bwc-disk-"
+	lvmSnapshotPrefix = "bwc-snap-"
+)
+
+// LVMFactory creates persistent disks as thin logical volumes in a thin pool.
+// Disk CIDs are only used to derive volume names; disk metadata is
+// recorded in metadata directory since volumes carry no properties.
+type LVMFactory struct {
+	volumeGroup string
+	thinPool    string
+	metadataDir string
+
+	fs        boshsys.FileSystem
+	uuidGen   boshuuid.Generator
+	cmdRunner boshsys.CmdRunner
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func NewLVMFactory(
+	volumeGroup string,
+	thinPool string,
+	metadataDir string,
+	fs boshsys.FileSystem,
+	uuidGen boshuuid.Generator,
+	cmdRunner boshsys.CmdRunner,
+	logger boshlog.Logger,
+) LVMFactory {
+	return LVMFactory{
+		volumeGroup: volumeGroup,
+		thinPool:    thinPool,
+		metadataDir: metadataDir,
+
+		fs:        fs,
+		uuidGen:   uuidGen,
+		cmdRunner: cmdRunner,
+
+		logTag: "disk.LVMFactory",
+		logger: logger,
+	}
+}
+
+func (f LVMFactory) Create(size int, props DiskProps) (Disk, error) {
+	f.logger.Debug(f.logTag, "Creating thin volume of size '%d'", size)
+
+	if props.Type != "" && props.Type != DiskTypeImage {
+		return nil, bosherr.Errorf("Disk type '%s' is not supported by configured disk backend", props.Type)
+	}
+
+	if props.Encrypted {
+		return nil, bosherr.Error("LVM disks cannot be encrypted")
+	}
+
+	id, err := f.uuidGen.Generate()
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating disk id")
+	}
+
+	props.Type = DiskTypeLVM
+
+	disk := f.newDisk(apiv1.NewDiskCID(id), fsMetadata{Props: props, Size: size})
+
+	_, _, _, err = f.cmdRunner.RunCommand(
+		"lvcreate", "--yes",
+		"--thin", "--virtualsize", strconv.Itoa(size)+"M",
+		"--name", disk.volumeName(),
+		f.volumeGroup+"/"+f.thinPool,
+	)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating thin volume '%s'", disk.volumeName())
+	}
+
+	_, _, _, err = f.cmdRunner.RunCommand("/sbin/mkfs", props.mkfsArgs(disk.Path())...)
+	if err != nil {
+		f.cleanUp(disk)
+		return nil, bosherr.WrapErrorf(err, "Building disk filesystem '%s'", disk.Path())
+	}
+
+	err = saveMetadata(f.fs, disk.metadataBasePath, fsMetadata{Props: props, Size: size})
+	if err != nil {
+		f.cleanUp(disk)
+		return nil, err
+	}
+
+	return disk, nil
+}
+
+func (f LVMFactory) Find(id apiv1.DiskCID) (Disk, error) {
+	metadata, err := loadMetadata(f.fs, filepath.Join(f.metadataDir, id.AsString()))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.Props.Type = DiskTypeLVM
+
+	return f.newDisk(id, metadata), nil
+}
+
+func (f LVMFactory) DeleteSnapshot(cid apiv1.SnapshotCID) error {
+	volume := f.volumeGroup + "/" + lvmSnapshotPrefix + cid.AsString()
+
+	_, _, _, err := f.cmdRunner.RunCommand("lvremove", "--yes", volume)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing snapshot volume '%s'", volume)
+	}
+
+	return nil
+}
+
+func (f LVMFactory) newDisk(id apiv1.DiskCID, metadata fsMetadata) LVMDisk {
+	return LVMDisk{
+		id:          id,
+		volumeGroup: f.volumeGroup,
+		props:       metadata.Props,
+		size:        metadata.Size,
+
+		metadataBasePath: filepath.Join(f.metadataDir, id.AsString()),
+
+		fs:        f.fs,
+		uuidGen:   f.uuidGen,
+		cmdRunner: f.cmdRunner,
+		logger:    f.logger,
+	}
+}
+
+func (f LVMFactory) cleanUp(disk LVMDisk) {
+	err := disk.Delete()
+	if err != nil {
+		f.logger.Error(f.logTag, "Failed deleting thin volume '%s': %s", disk.volumeName(), err.Error())
+	}
+}
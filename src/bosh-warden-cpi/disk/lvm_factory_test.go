@@ -0,0 +1,257 @@
+package disk_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-utils/uuid/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/disk"
+)
+
+var _ = Describe("LVMFactory", func() {
+	var (
+		fs        *fakesys.FakeFileSystem
+		uuidGen   *fakeuuid.FakeGenerator
+		cmdRunner *fakesys.FakeCmdRunner
+		factory   LVMFactory
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-uuid"}
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		factory = NewLVMFactory("fake-vg", "fake-pool", "/fake-disks-dir", fs, uuidGen, cmdRunner, logger)
+	})
+
+	Describe("Create", func() {
+		It("creates thin volume in thin pool and formats it", func() {
+			disk, err := factory.Create(40, DiskProps{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disk.ID()).To(Equal(apiv1.NewDiskCID("fake-uuid")))
+			Expect(disk.Path()).To(Equal("/dev/fake-vg/bwc-disk-fake-uuid"))
+			Expect(disk.Props()).To(Equal(DiskProps{Type: DiskTypeLVM}))
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"lvcreate", "--yes", "--thin", "--virtualsize", "40M", "--name", "bwc-disk-fake-uuid", "fake-vg/fake-pool"},
+				{"/sbin/mkfs", "-t", "ext4", "-F", "/dev/fake-vg/bwc-disk-fake-uuid"},
+			}))
+		})
+
+		It("records disk properties and size in disks directory", func() {
+			_, err := factory.Create(40, DiskProps{ReadOnly: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := fs.ReadFileString("/fake-disks-dir/fake-uuid.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(ContainSubstring(`"Type":"lvm"`))
+			Expect(contents).To(ContainSubstring(`"ReadOnly":true`))
+			Expect(contents).To(ContainSubstring(`"Size":40`))
+		})
+
+		It("returns error if creating thin volume fails", func() {
+			cmdRunner.AddCmdResult(
+				"lvcreate --yes --thin --virtualsize 40M --name bwc-disk-fake-uuid fake-vg/fake-pool",
+				fakesys.FakeCmdResult{Error: errors.New("fake-lvcreate-err")},
+			)
+
+			disk, err := factory.Create(40, DiskProps{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-lvcreate-err"))
+			Expect(disk).To(BeNil())
+		})
+
+		It("removes thin volume if formatting it fails", func() {
+			cmdRunner.AddCmdResult(
+				"/sbin/mkfs -t ext4 -F /dev/fake-vg/bwc-disk-fake-uuid",
+				fakesys.FakeCmdResult{Error: errors.New("fake-mkfs-err")},
+			)
+			cmdRunner.AddCmdResult("lvs --noheadings --options lv_name fake-vg", fakesys.FakeCmdResult{
+				Stdout: "  fake-pool\n  bwc-disk-fake-uuid\n",
+			})
+
+			disk, err := factory.Create(40, DiskProps{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-mkfs-err"))
+			Expect(disk).To(BeNil())
+
+			Expect(cmdRunner.RunCommands[3]).To(Equal(
+				[]string{"lvremove", "--yes", "fake-vg/bwc-disk-fake-uuid"}))
+		})
+	})
+
+	Describe("Find", func() {
+		It("returns disk with recorded properties", func() {
+			err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", `{"Props":{"ReadOnly":true},"Size":40}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			disk, err := factory.Find(apiv1.NewDiskCID("fake-disk-id"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disk.Path()).To(Equal("/dev/fake-vg/bwc-disk-fake-disk-id"))
+			Expect(disk.Props()).To(Equal(DiskProps{Type: DiskTypeLVM, ReadOnly: true}))
+		})
+	})
+
+	Describe("DeleteSnapshot", func() {
+		It("removes snapshot volume", func() {
+			err := factory.DeleteSnapshot(apiv1.NewSnapshotCID("fake-snap-id"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"lvremove", "--yes", "fake-vg/bwc-snap-fake-snap-id"},
+			}))
+		})
+
+		It("returns error if removing snapshot volume fails", func() {
+			cmdRunner.AddCmdResult("lvremove --yes fake-vg/bwc-snap-fake-snap-id", fakesys.FakeCmdResult{
+				Error: errors.New("fake-lvremove-err"),
+			})
+
+			err := factory.DeleteSnapshot(apiv1.NewSnapshotCID("fake-snap-id"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-lvremove-err"))
+		})
+	})
+})
+
+var _ = Describe("LVMDisk", func() {
+	var (
+		fs        *fakesys.FakeFileSystem
+		uuidGen   *fakeuuid.FakeGenerator
+		cmdRunner *fakesys.FakeCmdRunner
+		disk      Disk
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-snap-id"}
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		factory := NewLVMFactory("fake-vg", "fake-pool", "/fake-disks-dir", fs, uuidGen, cmdRunner, logger)
+
+		err := fs.WriteFileString("/fake-disks-dir/fake-disk-id.json", `{"Props":{},"Size":40}`)
+		Expect(err).ToNot(HaveOccurred())
+
+		disk, err = factory.Find(apiv1.NewDiskCID("fake-disk-id"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("Exists", func() {
+		It("returns true if volume group contains disk volume", func() {
+			cmdRunner.AddCmdResult("lvs --noheadings --options lv_name fake-vg", fakesys.FakeCmdResult{
+				Stdout: "  fake-pool\n  bwc-disk-fake-disk-id\n",
+			})
+
+			found, err := disk.Exists()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+		})
+
+		It("returns false if volume group does not contain disk volume", func() {
+			cmdRunner.AddCmdResult("lvs --noheadings --options lv_name fake-vg", fakesys.FakeCmdResult{
+				Stdout: "  fake-pool\n  bwc-disk-other-id\n",
+			})
+
+			found, err := disk.Exists()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("Delete", func() {
+		It("removes disk volume and its metadata", func() {
+			cmdRunner.AddCmdResult("lvs --noheadings --options lv_name fake-vg", fakesys.FakeCmdResult{
+				Stdout: "  bwc-disk-fake-disk-id\n",
+			})
+
+			err := disk.Delete()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands[1]).To(Equal([]string{"lvremove", "--yes", "fake-vg/bwc-disk-fake-disk-id"}))
+			Expect(fs.FileExists("/fake-disks-dir/fake-disk-id.json")).To(BeFalse())
+		})
+
+		It("only removes metadata if disk volume is already gone", func() {
+			err := disk.Delete()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(HaveLen(1))
+			Expect(fs.FileExists("/fake-disks-dir/fake-disk-id.json")).To(BeFalse())
+		})
+	})
+
+	Describe("Resize", func() {
+		It("extends volume and grows its filesystem", func() {
+			err := disk.(Resizer).Resize(80)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"findmnt", "--noheadings", "--source", "/dev/fake-vg/bwc-disk-fake-disk-id"},
+				{"lvs", "--noheadings", "--options", "lv_attr", "fake-vg/bwc-disk-fake-disk-id"},
+				{"lvextend", "--size", "80M", "fake-vg/bwc-disk-fake-disk-id"},
+				{"e2fsck", "-f", "-p", "/dev/fake-vg/bwc-disk-fake-disk-id"},
+				{"resize2fs", "/dev/fake-vg/bwc-disk-fake-disk-id"},
+			}))
+
+			contents, err := fs.ReadFileString("/fake-disks-dir/fake-disk-id.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(ContainSubstring(`"Size":80`))
+		})
+
+		It("returns error when shrinking", func() {
+			err := disk.(Resizer).Resize(20)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Shrinking disk 'fake-disk-id' from '40M' to '20M' is not supported"))
+			Expect(cmdRunner.RunCommands).To(HaveLen(2))
+		})
+
+		It("returns error if volume is mounted", func() {
+			cmdRunner.AddCmdResult("findmnt --noheadings --source /dev/fake-vg/bwc-disk-fake-disk-id", fakesys.FakeCmdResult{
+				Stdout: "/fake-mount-path /dev/mapper/fake--vg-bwc--disk--fake--disk--id ext4 rw\n",
+			})
+
+			err := disk.(Resizer).Resize(80)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Disk 'fake-disk-id' is in use; detach it before resizing"))
+			Expect(cmdRunner.RunCommands).To(HaveLen(1))
+		})
+
+		It("returns error if volume is open", func() {
+			cmdRunner.AddCmdResult("lvs --noheadings --options lv_attr fake-vg/bwc-disk-fake-disk-id", fakesys.FakeCmdResult{
+				Stdout: "  Vwi-aotz--\n",
+			})
+
+			err := disk.(Resizer).Resize(80)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Disk 'fake-disk-id' is in use; detach it before resizing"))
+			Expect(cmdRunner.RunCommands).To(HaveLen(2))
+		})
+
+		It("returns error if extending volume fails", func() {
+			cmdRunner.AddCmdResult("lvextend --size 80M fake-vg/bwc-disk-fake-disk-id", fakesys.FakeCmdResult{
+				Error: errors.New("fake-lvextend-err"),
+			})
+
+			err := disk.(Resizer).Resize(80)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-lvextend-err"))
+		})
+	})
+
+	Describe("Snapshot", func() {
+		It("creates thin snapshot of disk volume", func() {
+			snapshotCID, err := disk.(Snapshotter).Snapshot()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotCID).To(Equal(apiv1.NewSnapshotCID("fake-snap-id")))
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				{"lvcreate", "--snapshot", "--name", "bwc-snap-fake-snap-id", "fake-vg/bwc-disk-fake-disk-id"},
+			}))
+		})
+	})
+})
@@ -0,0 +1,117 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// TmpfsDisk is a persistent disk kept in memory by a size limited tmpfs
+// mounted in disks directory; its contents do not survive host reboots
+type TmpfsDisk struct {
+	id    apiv1.DiskCID
+	path  string
+	props DiskProps
+
+	fs        boshsys.FileSystem
+	cmdRunner boshsys.CmdRunner
+	logger    boshlog.Logger
+}
+
+func (s TmpfsDisk) ID() apiv1.DiskCID { return s.id }
+
+func (s TmpfsDisk) Path() string { return s.path }
+
+func (s TmpfsDisk) Props() DiskProps { return s.props }
+
+// Exists requires tmpfs to be mounted since disk directory
+// left behind by host reboot has lost disk contents
+func (s TmpfsDisk) Exists() (bool, error) {
+	if !s.fs.FileExists(s.path) {
+		return false, nil
+	}
+
+	stdout, _, exitStatus, err := s.cmdRunner.RunCommand(
+		"findmnt", "--noheadings", "--output", "FSTYPE", "--mountpoint", s.path)
+	if err != nil {
+		// findmnt exits with 1 when nothing is mounted at path
+		if exitStatus == 1 {
+			return false, nil
+		}
+		return false, bosherr.WrapErrorf(err, "Checking tmpfs mount of disk '%s'", s.path)
+	}
+
+	return strings.TrimSpace(stdout) == "tmpfs", nil
+}
+
+func (s TmpfsDisk) Delete() error {
+	if s.fs.FileExists(s.path) {
+		_, _, _, err := s.cmdRunner.RunCommand("umount", s.path)
+		if err != nil && !strings.Contains(err.Error(), "not mounted") {
+			return bosherr.WrapErrorf(err, "Unmounting disk '%s'", s.path)
+		}
+	}
+
+	err := s.fs.RemoveAll(s.path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting disk '%s'", s.path)
+	}
+
+	err = s.fs.RemoveAll(metadataPath(s.path))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting disk metadata '%s'", metadataPath(s.path))
+	}
+
+	return nil
+}
+
+func (f FSFactory) createTmpfs(id string, size int, props DiskProps) (Disk, error) {
+	diskPath := filepath.Join(f.dirPath, id)
+
+	err := f.fs.MkdirAll(diskPath, os.FileMode(0755))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating disk directory")
+	}
+
+	disk := f.newTmpfsDisk(apiv1.NewDiskCID(id), diskPath, props)
+
+	_, _, _, err = f.cmdRunner.RunCommand(
+		"mount", "-t", "tmpfs", "-o", "size="+strconv.Itoa(size)+"m,mode=0755", "tmpfs", diskPath)
+	if err != nil {
+		f.cleanUpTmpfs(disk)
+		return nil, bosherr.WrapErrorf(err, "Mounting tmpfs at '%s'", diskPath)
+	}
+
+	err = saveMetadata(f.fs, diskPath, fsMetadata{Props: props, Size: size})
+	if err != nil {
+		f.cleanUpTmpfs(disk)
+		return nil, err
+	}
+
+	return disk, nil
+}
+
+func (f FSFactory) newTmpfsDisk(id apiv1.DiskCID, diskPath string, props DiskProps) TmpfsDisk {
+	return TmpfsDisk{
+		id:    id,
+		path:  diskPath,
+		props: props,
+
+		fs:        f.fs,
+		cmdRunner: f.cmdRunner,
+		logger:    f.logger,
+	}
+}
+
+func (f FSFactory) cleanUpTmpfs(disk TmpfsDisk) {
+	err := disk.Delete()
+	if err != nil {
+		f.logger.Error(f.logTag, "Failed deleting tmpfs disk '%s': %s", disk.Path(), err.Error())
+	}
+}
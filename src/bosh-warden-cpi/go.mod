@@ -6,9 +6,12 @@ require (
 	code.cloudfoundry.org/garden v0.0.0-20260805020914-eb681524f408
 	github.com/cloudfoundry/bosh-cpi-go v0.0.0-20260727051557-721a1d47bcc3
 	github.com/cloudfoundry/bosh-utils v0.0.631
+	github.com/klauspost/compress v1.18.0
 	github.com/onsi/ginkgo/v2 v2.32.0
 	github.com/onsi/gomega v1.42.1
+	github.com/ulikunitz/xz v0.5.15
 	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/sys v0.47.0
 )
 
 require (
@@ -28,7 +31,6 @@ require (
 	golang.org/x/mod v0.38.0 // indirect
 	golang.org/x/net v0.57.0 // indirect
 	golang.org/x/sync v0.22.0 // indirect
-	golang.org/x/sys v0.47.0 // indirect
 	golang.org/x/text v0.40.0 // indirect
 	golang.org/x/tools v0.48.0 // indirect
 )
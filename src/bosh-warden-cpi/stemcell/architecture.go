@@ -0,0 +1,55 @@
+package stemcell
+
+import (
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"golang.org/x/sys/unix"
+)
+
+// NormalizeArchitecture converts architecture names used by stemcells and kernels
+// (e.g. x86_64, aarch64) into names used by Go and OCI images (amd64, arm64)
+func NormalizeArchitecture(arch string) string {
+	arch = strings.ToLower(arch)
+
+	switch arch {
+	case "x86_64", "x86-64", "x64":
+		return "amd64"
+	case "aarch64", "armv8":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	case "armv7l", "armv6l":
+		return "arm"
+	default:
+		return arch
+	}
+}
+
+// HostArchitecture returns architecture of running kernel in Go naming;
+// runtime.GOARCH cannot be used since CPI may be cross-compiled
+func HostArchitecture() (string, error) {
+	var uname unix.Utsname
+
+	err := unix.Uname(&uname)
+	if err != nil {
+		return "", bosherr.WrapError(err, "Getting host architecture")
+	}
+
+	return NormalizeArchitecture(unix.ByteSliceToString(uname.Machine[:])), nil
+}
+
+// CheckArchitecture returns error if stemcell cannot run on host architecture;
+// stemcells that do not specify architecture are assumed to be compatible
+func CheckArchitecture(metadata *Metadata, hostArch string) error {
+	arch := metadata.GetArchitecture()
+	if arch == "" {
+		return nil
+	}
+
+	if NormalizeArchitecture(arch) != NormalizeArchitecture(hostArch) {
+		return bosherr.Errorf("Stemcell architecture '%s' is not compatible with host architecture '%s'", arch, hostArch)
+	}
+
+	return nil
+}
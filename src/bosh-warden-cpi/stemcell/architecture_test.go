@@ -0,0 +1,49 @@
+package stemcell_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+)
+
+var _ = Describe("NormalizeArchitecture", func() {
+	It("converts kernel machine names into Go architecture names", func() {
+		Expect(NormalizeArchitecture("x86_64")).To(Equal("amd64"))
+		Expect(NormalizeArchitecture("aarch64")).To(Equal("arm64"))
+		Expect(NormalizeArchitecture("i686")).To(Equal("386"))
+		Expect(NormalizeArchitecture("armv7l")).To(Equal("arm"))
+		Expect(NormalizeArchitecture("s390x")).To(Equal("s390x"))
+	})
+})
+
+var _ = Describe("HostArchitecture", func() {
+	It("returns architecture of running kernel", func() {
+		arch, err := HostArchitecture()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(arch).ToNot(BeEmpty())
+		Expect(arch).To(Equal(NormalizeArchitecture(arch)))
+	})
+})
+
+var _ = Describe("CheckArchitecture", func() {
+	metadataWithArch := func(arch string) *Metadata {
+		return &Metadata{CloudProperties: CloudProperties{Architecture: arch}}
+	}
+
+	It("accepts stemcells without architecture", func() {
+		Expect(CheckArchitecture(metadataWithArch(""), "arm64")).To(Succeed())
+	})
+
+	It("accepts stemcells with kernel name of host architecture", func() {
+		Expect(CheckArchitecture(metadataWithArch("x86_64"), "amd64")).To(Succeed())
+		Expect(CheckArchitecture(metadataWithArch("aarch64"), "arm64")).To(Succeed())
+		Expect(CheckArchitecture(metadataWithArch("arm64"), "arm64")).To(Succeed())
+	})
+
+	It("rejects stemcells for other architectures", func() {
+		err := CheckArchitecture(metadataWithArch("x86_64"), "arm64")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Stemcell architecture 'x86_64' is not compatible with host architecture 'arm64'"))
+	})
+})
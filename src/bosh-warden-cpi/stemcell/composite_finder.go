@@ -7,19 +7,31 @@ import (
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	boshsys "github.com/cloudfoundry/bosh-utils/system"
+
+	"bosh-warden-cpi/util"
 )
 
 type CompositeFinder struct {
-	dirPath string
-	fs      boshsys.FileSystem
-	logger  boshlog.Logger
+	dirPath         string
+	registryMirrors RegistryMirrors
+	locker          util.FileLocker
+	fs              boshsys.FileSystem
+	logger          boshlog.Logger
 }
 
-func NewCompositeFinder(dirPath string, fs boshsys.FileSystem, logger boshlog.Logger) CompositeFinder {
+func NewCompositeFinder(
+	dirPath string,
+	registryMirrors RegistryMirrors,
+	locker util.FileLocker,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) CompositeFinder {
 	return CompositeFinder{
-		dirPath: dirPath,
-		fs:      fs,
-		logger:  logger,
+		dirPath:         dirPath,
+		registryMirrors: registryMirrors,
+		locker:          locker,
+		fs:              fs,
+		logger:          logger,
 	}
 }
 
@@ -28,13 +40,25 @@ func (f CompositeFinder) Find(id apiv1.StemcellCID) (Stemcell, bool, error) {
 
 	if strings.HasPrefix(cidString, "light://") {
 		imageReference := strings.TrimPrefix(cidString, "light://")
-		return NewLightStemcell(id, imageReference, f.logger), true, nil
+
+		var layoutPath string
+		if path := LightStemcellLayoutPath(f.dirPath, id); f.fs.FileExists(filepath.Join(path, ociLayoutFileName)) {
+			layoutPath = path
+		}
+
+		return NewLightStemcell(
+			id, f.registryMirrors.Rewrite(imageReference), f.dirPath, layoutPath, f.fs, f.logger), true, nil
 	}
 
 	stemcellDir := filepath.Join(f.dirPath, cidString)
+	if f.fs.FileExists(filepath.Join(stemcellDir, ociLayoutFileName)) {
+		return NewOCIStemcell(id, stemcellDir, f.fs, f.logger), true, nil
+	}
+
+	// Stemcells imported by versions that unpacked every import separately
 	if f.fs.FileExists(stemcellDir) {
 		return NewFSStemcell(id, stemcellDir, f.fs, f.logger), true, nil
 	}
 
-	return nil, false, nil
+	return findSharedFSStemcell(f.dirPath, id, f.locker, f.fs, f.logger)
 }
@@ -0,0 +1,88 @@
+package stemcell_test
+
+import (
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("CompositeFinder", func() {
+	var (
+		fs     *fakesys.FakeFileSystem
+		finder CompositeFinder
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		mirrors := RegistryMirrors{"docker.io/": "registry.local:5000/"}
+		finder = NewCompositeFinder(
+			"/fake-stemcells-dir", mirrors, util.NewRecordingNoopLocker(), fs, boshlog.NewLogger(boshlog.LevelNone))
+	})
+
+	It("returns light stemcell pulled from registry mirror", func() {
+		stemcell, found, err := finder.Find(apiv1.NewStemcellCID("light://bosh/warden-stemcell:1.0"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(stemcell.ID()).To(Equal(apiv1.NewStemcellCID("light://bosh/warden-stemcell:1.0")))
+		Expect(stemcell.URI()).To(Equal("docker://registry.local:5000/bosh/warden-stemcell:1.0"))
+	})
+
+	It("returns light stemcell backed by pre-pulled image", func() {
+		cid := apiv1.NewStemcellCID("light://bosh/warden-stemcell:1.0")
+		layoutPath := LightStemcellLayoutPath("/fake-stemcells-dir", cid)
+
+		err := fs.WriteFileString(layoutPath+"/oci-layout", "{}")
+		Expect(err).ToNot(HaveOccurred())
+
+		stemcell, found, err := finder.Find(cid)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(stemcell.URI()).To(Equal("oci://" + layoutPath))
+	})
+
+	It("returns stemcell from stemcells directory", func() {
+		err := fs.MkdirAll("/fake-stemcells-dir/fake-stemcell-id", 0755)
+		Expect(err).ToNot(HaveOccurred())
+
+		stemcell, found, err := finder.Find(apiv1.NewStemcellCID("fake-stemcell-id"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(stemcell.URI()).To(Equal("/fake-stemcells-dir/fake-stemcell-id"))
+	})
+
+	It("returns stemcell sharing directory of identical stemcells", func() {
+		err := fs.WriteFileString("/fake-stemcells-dir/fake-checksum/refs/fake-stemcell-id", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		fs.SetGlob("/fake-stemcells-dir/*/refs/fake-stemcell-id", []string{
+			"/fake-stemcells-dir/fake-checksum/refs/fake-stemcell-id",
+		})
+
+		stemcell, found, err := finder.Find(apiv1.NewStemcellCID("fake-stemcell-id"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(stemcell.ID()).To(Equal(apiv1.NewStemcellCID("fake-stemcell-id")))
+		Expect(stemcell.URI()).To(Equal("/fake-stemcells-dir/fake-checksum/image"))
+	})
+
+	It("returns OCI stemcell if stemcell directory is an image layout", func() {
+		err := fs.WriteFileString("/fake-stemcells-dir/fake-stemcell-id/oci-layout", "{}")
+		Expect(err).ToNot(HaveOccurred())
+
+		stemcell, found, err := finder.Find(apiv1.NewStemcellCID("fake-stemcell-id"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(stemcell.URI()).To(Equal("oci:///fake-stemcells-dir/fake-stemcell-id"))
+	})
+
+	It("returns not found if stemcell directory does not exist", func() {
+		_, found, err := finder.Find(apiv1.NewStemcellCID("fake-stemcell-id"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+})
@@ -12,24 +12,37 @@ import (
 type CompositeImporter struct {
 	fsImporter     FSImporter
 	lightImporter  LightImporter
+	ociImporter    OCIImporter
 	metadataParser MetadataParser
 
+	hostArch string
+
 	logTag string
 	logger boshlog.Logger
 }
 
 func NewCompositeImporter(
 	dirPath string,
+	hostArch string,
+	registryMirrors RegistryMirrors,
+	imageResolver ImageResolver,
+	imagePuller ImagePuller,
 	fs boshsys.FileSystem,
 	uuidGen boshuuid.Generator,
 	decompressor util.Decompressor,
+	ociDecompressor util.Decompressor,
+	locker util.FileLocker,
 	logger boshlog.Logger,
 ) CompositeImporter {
 	return CompositeImporter{
-		fsImporter:     NewFSImporter(dirPath, fs, uuidGen, decompressor, logger),
-		lightImporter:  NewLightImporter(fs, logger),
+		fsImporter: NewFSImporter(dirPath, fs, uuidGen, decompressor, locker, logger),
+		lightImporter: NewLightImporter(
+			dirPath, hostArch, registryMirrors, imageResolver, imagePuller, fs, uuidGen, logger),
+		ociImporter:    NewOCIImporter(dirPath, fs, uuidGen, ociDecompressor, logger),
 		metadataParser: NewMetadataParser(fs),
 
+		hostArch: hostArch,
+
 		logTag: "CompositeImporter",
 		logger: logger,
 	}
@@ -38,16 +51,28 @@ func NewCompositeImporter(
 func (i CompositeImporter) ImportFromPath(imagePath string) (Stemcell, error) {
 	i.logger.Debug(i.logTag, "Detecting stemcell type for '%s'", imagePath)
 
-	_, isLight, err := i.metadataParser.ParseFromPath(imagePath)
+	metadata, isLight, err := i.metadataParser.ParseFromPath(imagePath)
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Parsing stemcell metadata")
 	}
 
+	if metadata != nil {
+		err = CheckArchitecture(metadata, i.hostArch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if isLight {
 		i.logger.Debug(i.logTag, "Detected light stemcell, using LightImporter")
 		return i.lightImporter.ImportFromPath(imagePath)
 	}
 
+	if metadata != nil && metadata.IsOCIStemcell() {
+		i.logger.Debug(i.logTag, "Detected OCI stemcell, using OCIImporter")
+		return i.ociImporter.ImportFromPath(imagePath)
+	}
+
 	i.logger.Debug(i.logTag, "Detected traditional stemcell, using FSImporter")
 	return i.fsImporter.ImportFromPath(imagePath)
 }
@@ -4,12 +4,17 @@ type FakeDecompressor struct {
 	DecompressSrcForCall []string
 	DecompressDstForCall []string
 
-	DecompressError error
+	DecompressCallback func(src, dst string)
+	DecompressError    error
 }
 
 func (f *FakeDecompressor) Decompress(src, dst string) error {
 	f.DecompressSrcForCall = append(f.DecompressSrcForCall, src)
 	f.DecompressDstForCall = append(f.DecompressDstForCall, dst)
 
+	if f.DecompressCallback != nil {
+		f.DecompressCallback(src, dst)
+	}
+
 	return f.DecompressError
 }
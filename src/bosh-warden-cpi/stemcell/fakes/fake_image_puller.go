@@ -0,0 +1,25 @@
+package fakes
+
+import (
+	bwcstem "bosh-warden-cpi/stemcell"
+)
+
+type FakeImagePuller struct {
+	PullRef    bwcstem.ImageReference
+	PullDstDir string
+
+	PullCallback func(dstDir string)
+	PullDigest   string
+	PullErr      error
+}
+
+func (p *FakeImagePuller) Pull(ref bwcstem.ImageReference, dstDir string) (string, error) {
+	p.PullRef = ref
+	p.PullDstDir = dstDir
+
+	if p.PullCallback != nil {
+		p.PullCallback(dstDir)
+	}
+
+	return p.PullDigest, p.PullErr
+}
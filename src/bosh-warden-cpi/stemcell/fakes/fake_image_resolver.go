@@ -0,0 +1,20 @@
+package fakes
+
+import (
+	bwcstem "bosh-warden-cpi/stemcell"
+)
+
+type FakeImageResolver struct {
+	ResolveRef  bwcstem.ImageReference
+	ResolveArch string
+
+	ResolveDigest string
+	ResolveErr    error
+}
+
+func (r *FakeImageResolver) Resolve(ref bwcstem.ImageReference, arch string) (string, error) {
+	r.ResolveRef = ref
+	r.ResolveArch = arch
+
+	return r.ResolveDigest, r.ResolveErr
+}
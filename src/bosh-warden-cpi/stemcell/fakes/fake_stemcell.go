@@ -2,14 +2,25 @@ package fakes
 
 import (
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+
+	bwcstem "bosh-warden-cpi/stemcell"
 )
 
 type FakeStemcell struct {
 	id  apiv1.StemcellCID
 	uri string
 
-	DeleteCalled bool
-	DeleteErr    error
+	MetadataResult *bwcstem.Metadata
+	MetadataErr    error
+
+	LockImageCalled bool
+	LockImageHeld   bool
+	LockImageErr    error
+
+	// DeleteChecksUnused makes Delete call checkUnused like stemcells that remove images
+	DeleteChecksUnused bool
+	DeleteCalled       bool
+	DeleteErr          error
 }
 
 func NewFakeStemcell(id apiv1.StemcellCID) *FakeStemcell {
@@ -24,7 +35,31 @@ func (s FakeStemcell) ID() apiv1.StemcellCID { return s.id }
 
 func (s FakeStemcell) URI() string { return s.uri }
 
-func (s *FakeStemcell) Delete() error {
+func (s FakeStemcell) Metadata() (*bwcstem.Metadata, error) {
+	return s.MetadataResult, s.MetadataErr
+}
+
+func (s *FakeStemcell) LockImage() (func(), error) {
+	s.LockImageCalled = true
+
+	if s.LockImageErr != nil {
+		return nil, s.LockImageErr
+	}
+
+	s.LockImageHeld = true
+
+	return func() { s.LockImageHeld = false }, nil
+}
+
+func (s *FakeStemcell) Delete(checkUnused func() error) error {
 	s.DeleteCalled = true
+
+	if s.DeleteChecksUnused {
+		err := checkUnused()
+		if err != nil {
+			return err
+		}
+	}
+
 	return s.DeleteErr
 }
@@ -1,8 +1,17 @@
 package stemcell
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"bosh-warden-cpi/util"
 
@@ -13,12 +22,19 @@ import (
 	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
 )
 
+// Staging directories are named .staging-<pid>-<checksum>
+const stagingDirPrefix = ".staging-"
+
+var checksumRegexp = regexp.MustCompile(`^(sha1|sha256|sha512)-[a-f0-9]+$`)
+
 type FSImporter struct {
 	dirPath string
 
-	fs           boshsys.FileSystem
-	uuidGen      boshuuid.Generator
-	decompressor util.Decompressor
+	fs             boshsys.FileSystem
+	uuidGen        boshuuid.Generator
+	decompressor   util.Decompressor
+	locker         util.FileLocker
+	metadataParser MetadataParser
 
 	logTag string
 	logger boshlog.Logger
@@ -29,41 +45,217 @@ func NewFSImporter(
 	fs boshsys.FileSystem,
 	uuidGen boshuuid.Generator,
 	decompressor util.Decompressor,
+	locker util.FileLocker,
 	logger boshlog.Logger,
 ) FSImporter {
 	return FSImporter{
 		dirPath: dirPath,
 
-		fs:           fs,
-		uuidGen:      uuidGen,
-		decompressor: decompressor,
+		fs:             fs,
+		uuidGen:        uuidGen,
+		decompressor:   decompressor,
+		locker:         locker,
+		metadataParser: NewMetadataParser(fs),
 
 		logTag: "FSImporter",
 		logger: logger,
 	}
 }
 
+// ImportFromPath unpacks stemcell into directory named after image checksum
+// so that identical stemcells imported several times share single directory;
+// every import still gets CID of its own which references that directory.
+// Stemcell is unpacked into staging directory first and is only moved into place
+// once unpacked completely so that interrupted imports are never found.
 func (i FSImporter) ImportFromPath(imagePath string) (Stemcell, error) {
 	i.logger.Debug(i.logTag, "Importing stemcell from path '%s'", imagePath)
 
+	metadata, _, err := i.metadataParser.ParseFromPath(imagePath)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Parsing stemcell metadata")
+	}
+
+	checksum, err := i.verifiedChecksum(imagePath, metadata)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Verifying stemcell checksum")
+	}
+
 	id, err := i.uuidGen.Generate()
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Generating stemcell id")
 	}
 
+	cid := apiv1.NewStemcellCID(id)
+
 	err = i.fs.MkdirAll(i.dirPath, os.FileMode(0755))
 	if err != nil {
 		return nil, bosherr.WrapErrorf(err, "Creating directory '%s'", i.dirPath)
 	}
 
-	stemcellPath := filepath.Join(i.dirPath, id)
+	stemcellPath := filepath.Join(i.dirPath, checksum)
+
+	// Concurrent imports and deletions of identical stemcells must not
+	// remove or replace directory that other imports are referencing
+	unlock, err := i.locker.Lock(sharedStemcellLockPath(stemcellPath))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Locking stemcell '%s'", stemcellPath)
+	}
+	defer unlock()
+
+	i.cleanUpStagingDirs()
+
+	refs := newStemcellRefs(stemcellPath, i.fs)
+
+	count, err := refs.Count()
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Referencing stemcell '%s'", stemcellPath)
+	}
+
+	if i.fs.FileExists(stemcellPath) && count > 0 {
+		err = refs.Add(cid)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Referencing stemcell '%s'", stemcellPath)
+		}
+
+		i.logger.Debug(i.logTag, "Reusing unpacked stemcell '%s' for stemcell '%s'", stemcellPath, cid)
+
+		return NewSharedFSStemcell(cid, stemcellPath, i.locker, i.fs, i.logger), nil
+	}
+
+	// Directory without references was left behind by interrupted deletion
+	// or was not completely unpacked by versions that unpacked stemcells in place
+	err = i.fs.RemoveAll(stemcellPath)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Removing incomplete stemcell '%s'", stemcellPath)
+	}
+
+	stagingPath := filepath.Join(i.dirPath, fmt.Sprintf("%s%d-%s", stagingDirPrefix, os.Getpid(), checksum))
+
+	err = i.fs.MkdirAll(stagingPath, os.FileMode(0755))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating staging directory '%s'", stagingPath)
+	}
+
+	stagingImagePath := filepath.Join(stagingPath, sharedStemcellImageName)
+
+	err = i.decompressor.Decompress(imagePath, stagingImagePath)
+	if err != nil {
+		i.removeAll(stagingPath)
+		return nil, bosherr.WrapErrorf(err, "Unpacking stemcell '%s' to '%s'", imagePath, stagingImagePath)
+	}
+
+	// Metadata and reference are recorded before directory is moved into place
+	// so that directory is complete as soon as it can be found
+	err = newMetadataStore(stagingImagePath, i.fs).Save(metadata)
+	if err != nil {
+		i.removeAll(stagingPath)
+		return nil, bosherr.WrapErrorf(err, "Recording metadata of stemcell '%s'", stemcellPath)
+	}
+
+	err = newStemcellRefs(stagingPath, i.fs).Add(cid)
+	if err != nil {
+		i.removeAll(stagingPath)
+		return nil, bosherr.WrapErrorf(err, "Referencing stemcell '%s'", stemcellPath)
+	}
 
-	err = i.decompressor.Decompress(imagePath, stemcellPath)
+	err = i.fs.Rename(stagingPath, stemcellPath)
 	if err != nil {
-		return nil, bosherr.WrapErrorf(err, "Unpacking stemcell '%s' to '%s'", imagePath, stemcellPath)
+		i.removeAll(stagingPath)
+		return nil, bosherr.WrapErrorf(err, "Moving unpacked stemcell to '%s'", stemcellPath)
 	}
 
 	i.logger.Debug(i.logTag, "Imported stemcell from path '%s'", imagePath)
 
-	return NewFSStemcell(apiv1.NewStemcellCID(id), stemcellPath, i.fs, i.logger), nil
+	return NewSharedFSStemcell(cid, stemcellPath, i.locker, i.fs, i.logger), nil
+}
+
+// verifiedChecksum calculates image checksum (e.g. sha1-<hex>) and makes sure
+// it matches checksum recorded in stemcell metadata when there is one
+func (i FSImporter) verifiedChecksum(imagePath string, metadata *Metadata) (string, error) {
+	expectedChecksum := ""
+
+	if metadata != nil && metadata.Sha1 != "" {
+		// Multiple digests are separated with ';', e.g. <sha1>;sha256:<sha256>
+		digest := strings.ToLower(strings.Split(metadata.Sha1, ";")[0])
+
+		expectedChecksum = "sha1-" + digest
+		if algo, hexDigest, found := strings.Cut(digest, ":"); found {
+			expectedChecksum = algo + "-" + hexDigest
+		}
+
+		if !checksumRegexp.MatchString(expectedChecksum) {
+			return "", bosherr.Errorf("Stemcell metadata has invalid sha1 '%s'", metadata.Sha1)
+		}
+	}
+
+	algo := "sha1"
+	if expectedChecksum != "" {
+		algo, _, _ = strings.Cut(expectedChecksum, "-")
+	}
+
+	checksum, err := i.calculateChecksum(imagePath, algo)
+	if err != nil {
+		return "", err
+	}
+
+	if expectedChecksum != "" && checksum != expectedChecksum {
+		return "", bosherr.Errorf(
+			"Stemcell image '%s' has checksum '%s' but stemcell metadata expects '%s'", imagePath, checksum, expectedChecksum)
+	}
+
+	return checksum, nil
+}
+
+func (i FSImporter) calculateChecksum(imagePath, algo string) (string, error) {
+	var hasher hash.Hash
+
+	switch algo {
+	case "sha256":
+		hasher = sha256.New()
+	case "sha512":
+		hasher = sha512.New()
+	default:
+		hasher = sha1.New()
+	}
+
+	file, err := i.fs.OpenFile(imagePath, os.O_RDONLY, 0)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Opening stemcell image '%s'", imagePath)
+	}
+	defer file.Close() //nolint:errcheck
+
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Calculating %s of stemcell image '%s'", algo, imagePath)
+	}
+
+	return algo + "-" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// cleanUpStagingDirs removes staging directories left behind
+// by imports whose processes are no longer running
+func (i FSImporter) cleanUpStagingDirs() {
+	stagingPaths, err := i.fs.Glob(filepath.Join(i.dirPath, stagingDirPrefix+"*"))
+	if err != nil {
+		i.logger.Error(i.logTag, "Failed to find staging directories: %s", err)
+		return
+	}
+
+	for _, stagingPath := range stagingPaths {
+		pid, _, _ := strings.Cut(strings.TrimPrefix(filepath.Base(stagingPath), stagingDirPrefix), "-")
+
+		if i.fs.FileExists(filepath.Join("/proc", pid)) {
+			continue
+		}
+
+		i.logger.Debug(i.logTag, "Removing leftover staging directory '%s'", stagingPath)
+		i.removeAll(stagingPath)
+	}
+}
+
+func (i FSImporter) removeAll(path string) {
+	err := i.fs.RemoveAll(path)
+	if err != nil {
+		i.logger.Error(i.logTag, "Failed to remove '%s': %s", path, err)
+	}
 }
@@ -2,6 +2,7 @@ package stemcell_test
 
 import (
 	"errors"
+	"fmt"
 	"os"
 
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
@@ -13,29 +14,45 @@ import (
 
 	. "bosh-warden-cpi/stemcell"
 	"bosh-warden-cpi/stemcell/fakes"
+	"bosh-warden-cpi/util"
 )
 
 var _ = Describe("FSImporter", func() {
+	const (
+		// sha1 of fake-image-contents
+		imageChecksum = "sha1-f8e9d8968ee3c0b6d088a2f9d60fba05ca06f705"
+
+		stemcellPath = "/fake-collection-dir/" + imageChecksum
+	)
+
 	var (
 		fs           *fakesys.FakeFileSystem
 		uuidGen      *fakeuuid.FakeGenerator
 		decompressor *fakes.FakeDecompressor
+		locker       *util.RecordingNoopLocker
 		logger       boshlog.Logger
 		importer     FSImporter
 	)
 
 	BeforeEach(func() {
 		fs = fakesys.NewFakeFileSystem()
-		uuidGen = &fakeuuid.FakeGenerator{}
-		decompressor = &fakes.FakeDecompressor{}
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-uuid"}
+		decompressor = &fakes.FakeDecompressor{
+			DecompressCallback: func(_, dst string) {
+				err := fs.MkdirAll(dst, os.FileMode(0755))
+				Expect(err).ToNot(HaveOccurred())
+			},
+		}
+		locker = util.NewRecordingNoopLocker()
 		logger = boshlog.NewLogger(boshlog.LevelNone)
-		importer = NewFSImporter("/fake-collection-dir", fs, uuidGen, decompressor, logger)
+		importer = NewFSImporter("/fake-collection-dir", fs, uuidGen, decompressor, locker, logger)
+
+		err := fs.WriteFileString("/fake-image-path", "fake-image-contents")
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	Describe("ImportFromPath", func() {
 		It("makes the directory in which to unpack the stemcell", func() {
-			uuidGen.GeneratedUUID = "fake-uuid"
-
 			_, err := importer.ImportFromPath("/fake-image-path")
 			Expect(err).ToNot(HaveOccurred())
 
@@ -46,34 +63,209 @@ var _ = Describe("FSImporter", func() {
 			Expect(stat.Mode()).To(Equal(os.FileMode(0755)))
 		})
 
-		It("returns unique stemcell id", func() {
-			uuidGen.GeneratedUUID = "fake-uuid"
-
+		It("returns stemcell with generated id backed by directory named after image checksum", func() {
 			stemcell, err := importer.ImportFromPath("/fake-image-path")
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedStemcell := NewFSStemcell(
-				apiv1.NewStemcellCID("fake-uuid"), "/fake-collection-dir/fake-uuid", fs, logger)
+			expectedStemcell := NewSharedFSStemcell(
+				apiv1.NewStemcellCID("fake-uuid"), stemcellPath, locker, fs, logger)
 			Expect(stemcell).To(Equal(expectedStemcell))
+			Expect(stemcell.URI()).To(Equal(stemcellPath + "/image"))
+
+			Expect(fs.FileExists(stemcellPath + "/refs/fake-uuid")).To(BeTrue())
 		})
 
-		It("returns error if generating stemcell id fails", func() {
-			uuidGen.GenerateError = errors.New("fake-generate-err")
+		It("holds lock of stemcell directory while importing", func() {
+			decompressor.DecompressCallback = func(_, dst string) {
+				Expect(locker.IsHeld(stemcellPath + ".lock")).To(BeTrue())
+			}
 
+			_, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(locker.LockedPaths()).To(Equal([]string{stemcellPath + ".lock"}))
+			Expect(locker.IsHeld(stemcellPath + ".lock")).To(BeFalse())
+		})
+
+		It("verifies image against checksum from stemcell metadata", func() {
+			err := fs.WriteFileString("/fake-stemcell/image", "fake-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF", `---
+name: fake-name
+version: "1"
+sha1: F8E9D8968EE3C0B6D088A2F9D60FBA05CA06F705;sha256:aaaa
+stemcell_formats: [warden-tar]
+`)
+			Expect(err).ToNot(HaveOccurred())
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stemcell.URI()).To(Equal(stemcellPath + "/image"))
+
+			metadata, err := stemcell.Metadata()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata.String()).To(Equal("fake-name/1"))
+			Expect(metadata.StemcellFormats).To(Equal([]string{"warden-tar"}))
+		})
+
+		It("records no metadata for stemcells without metadata", func() {
 			stemcell, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+
+			metadata, err := stemcell.Metadata()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata).To(BeNil())
+		})
+
+		It("verifies image against sha256 checksum from stemcell metadata", func() {
+			err := fs.WriteFileString("/fake-stemcell/image", "fake-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF",
+				"sha1: sha256:b79d1ea51883a80a66b40ebd473c210509d2bba21ff3981ff2be56b39866cbe1\n")
+			Expect(err).ToNot(HaveOccurred())
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stemcell.URI()).To(Equal(
+				"/fake-collection-dir/sha256-b79d1ea51883a80a66b40ebd473c210509d2bba21ff3981ff2be56b39866cbe1/image"))
+		})
+
+		It("returns error without unpacking if image does not match checksum from stemcell metadata", func() {
+			err := fs.WriteFileString("/fake-stemcell/image", "corrupted-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF", "sha1: f8e9d8968ee3c0b6d088a2f9d60fba05ca06f705\n")
+			Expect(err).ToNot(HaveOccurred())
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("fake-generate-err"))
+			Expect(err.Error()).To(ContainSubstring("but stemcell metadata expects '" + imageChecksum + "'"))
 			Expect(stemcell).To(BeNil())
+
+			Expect(decompressor.DecompressSrcForCall).To(BeEmpty())
 		})
 
-		It("unpacks stemcell into directory that will contain this unpacked stemcell", func() {
-			uuidGen.GeneratedUUID = "fake-uuid"
+		It("returns error if stemcell metadata has invalid checksum", func() {
+			err := fs.WriteFileString("/fake-stemcell/image", "fake-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF", "sha1: ../../etc\n")
+			Expect(err).ToNot(HaveOccurred())
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Stemcell metadata has invalid sha1 '../../etc'"))
+			Expect(stemcell).To(BeNil())
+		})
+
+		It("returns error if image cannot be read to calculate checksum", func() {
+			fs.OpenFileErr = errors.New("fake-open-file-err")
+
+			stemcell, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-open-file-err"))
+			Expect(stemcell).To(BeNil())
+		})
+
+		It("unpacks stemcell into staging directory and moves it into place", func() {
+			stagingPath := fmt.Sprintf("/fake-collection-dir/.staging-%d-%s", os.Getpid(), imageChecksum)
+
+			decompressor.DecompressCallback = func(_, dst string) {
+				err := fs.WriteFileString(dst+"/rootfs-file", "")
+				Expect(err).ToNot(HaveOccurred())
+			}
 
 			_, err := importer.ImportFromPath("/fake-image-path")
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(decompressor.DecompressSrcForCall[0]).To(Equal("/fake-image-path"))
-			Expect(decompressor.DecompressDstForCall[0]).To(Equal("/fake-collection-dir/fake-uuid"))
+			Expect(decompressor.DecompressDstForCall[0]).To(Equal(stagingPath + "/image"))
+
+			Expect(fs.FileExists(stagingPath)).To(BeFalse())
+			Expect(fs.FileExists(stemcellPath + "/image/rootfs-file")).To(BeTrue())
+		})
+
+		It("removes staging directories left behind by processes that are no longer running", func() {
+			err := fs.MkdirAll("/fake-collection-dir/.staging-123-sha1-abc", os.FileMode(0755))
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.MkdirAll("/fake-collection-dir/.staging-456-sha1-def", os.FileMode(0755))
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.MkdirAll("/proc/456", os.FileMode(0755))
+			Expect(err).ToNot(HaveOccurred())
+
+			fs.SetGlob("/fake-collection-dir/.staging-*", []string{
+				"/fake-collection-dir/.staging-123-sha1-abc",
+				"/fake-collection-dir/.staging-456-sha1-def",
+			})
+
+			_, err = importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-collection-dir/.staging-123-sha1-abc")).To(BeFalse())
+			Expect(fs.FileExists("/fake-collection-dir/.staging-456-sha1-def")).To(BeTrue())
+		})
+
+		It("records metadata and reference in staging directory before moving it into place", func() {
+			stagingPath := fmt.Sprintf("/fake-collection-dir/.staging-%d-%s", os.Getpid(), imageChecksum)
+
+			err := fs.WriteFileString("/fake-stemcell/image", "fake-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF", "name: fake-name\nversion: \"1\"\n")
+			Expect(err).ToNot(HaveOccurred())
+
+			// Staging directory is removed once moving it into place fails
+			fs.RenameError = errors.New("fake-rename-err")
+
+			var stagedPaths []string
+
+			fs.RemoveAllStub = func(path string) error {
+				if path == stagingPath {
+					for _, stagedPath := range []string{"/image.metadata.yml", "/refs/fake-uuid"} {
+						if fs.FileExists(stagingPath + stagedPath) {
+							stagedPaths = append(stagedPaths, stagedPath)
+						}
+					}
+				}
+				return nil
+			}
+
+			_, err = importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).To(HaveOccurred())
+
+			Expect(stagedPaths).To(Equal([]string{"/image.metadata.yml", "/refs/fake-uuid"}))
+		})
+
+		It("reuses unpacked stemcell when identical stemcell is imported again", func() {
+			stemcell1, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+
+			uuidGen.GeneratedUUID = "other-fake-uuid"
+
+			stemcell2, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stemcell2.ID()).To(Equal(apiv1.NewStemcellCID("other-fake-uuid")))
+			Expect(stemcell2.URI()).To(Equal(stemcell1.URI()))
+
+			Expect(decompressor.DecompressSrcForCall).To(HaveLen(1))
+
+			Expect(fs.FileExists(stemcellPath + "/refs/fake-uuid")).To(BeTrue())
+			Expect(fs.FileExists(stemcellPath + "/refs/other-fake-uuid")).To(BeTrue())
+		})
+
+		It("unpacks stemcell again if stemcell directory is not referenced by any import", func() {
+			err := fs.WriteFileString(stemcellPath+"/partial-file", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(decompressor.DecompressSrcForCall).To(HaveLen(1))
+			Expect(fs.FileExists(stemcellPath + "/partial-file")).To(BeFalse())
 		})
 
 		It("returns error if creating directory fails", func() {
@@ -85,13 +277,27 @@ var _ = Describe("FSImporter", func() {
 			Expect(stemcell).To(BeNil())
 		})
 
-		It("returns error if unpacking stemcell fails", func() {
+		It("returns error and removes staging directory if unpacking stemcell fails", func() {
 			decompressor.DecompressError = errors.New("fake-decompress-error")
 
 			stemcell, err := importer.ImportFromPath("/fake-image-path")
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("fake-decompress-err"))
 			Expect(stemcell).To(BeNil())
+
+			Expect(fs.FileExists(stemcellPath)).To(BeFalse())
+			Expect(fs.FileExists(decompressor.DecompressDstForCall[0])).To(BeFalse())
+		})
+
+		It("returns error if moving unpacked stemcell into place fails", func() {
+			fs.RenameError = errors.New("fake-rename-err")
+
+			stemcell, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-rename-err"))
+			Expect(stemcell).To(BeNil())
+
+			Expect(fs.FileExists(decompressor.DecompressDstForCall[0])).To(BeFalse())
 		})
 	})
 })
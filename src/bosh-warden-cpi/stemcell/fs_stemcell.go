@@ -28,13 +28,26 @@ func (s FSStemcell) ID() apiv1.StemcellCID { return s.id }
 
 func (s FSStemcell) URI() string { return s.dirPath }
 
-func (s FSStemcell) Delete() error {
+func (s FSStemcell) Metadata() (*Metadata, error) {
+	return newMetadataStore(s.dirPath, s.fs).Load()
+}
+
+func (s FSStemcell) LockImage() (func(), error) { return func() {}, nil }
+
+// Delete removes stemcell unpacked into directory of its own
+// by versions that did not share directories between imports
+func (s FSStemcell) Delete(checkUnused func() error) error {
 	s.logger.Debug("FSStemcell", "Deleting stemcell '%s'", s.id)
 
-	err := s.fs.RemoveAll(s.dirPath)
+	err := checkUnused()
+	if err != nil {
+		return err
+	}
+
+	err = s.fs.RemoveAll(s.dirPath)
 	if err != nil {
 		return bosherr.WrapErrorf(err, "Deleting stemcell directory '%s'", s.dirPath)
 	}
 
-	return nil
+	return newMetadataStore(s.dirPath, s.fs).Delete()
 }
@@ -31,18 +31,46 @@ var _ = Describe("FSImporter", func() {
 			err := fs.MkdirAll("/fake-stemcell-dir", os.ModeDir)
 			Expect(err).ToNot(HaveOccurred())
 
-			err = stemcell.Delete()
+			err = stemcell.Delete(func() error { return nil })
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(fs.FileExists("/fake-stemcell-dir")).To(BeFalse())
 		})
 
+		It("deletes recorded stemcell metadata", func() {
+			err := fs.MkdirAll("/fake-stemcell-dir", os.ModeDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell-dir.metadata.yml", "name: fake-name\n")
+			Expect(err).ToNot(HaveOccurred())
+
+			metadata, err := stemcell.Metadata()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata.Name).To(Equal("fake-name"))
+
+			err = stemcell.Delete(func() error { return nil })
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-stemcell-dir.metadata.yml")).To(BeFalse())
+		})
+
+		It("keeps stemcell directory if it is still used", func() {
+			err := fs.MkdirAll("/fake-stemcell-dir", os.ModeDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = stemcell.Delete(func() error { return errors.New("fake-used-err") })
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-used-err"))
+
+			Expect(fs.FileExists("/fake-stemcell-dir")).To(BeTrue())
+		})
+
 		It("returns error if deleting stemcell directory fails", func() {
 			fs.RemoveAllStub = func(string) error {
 				return errors.New("fake-remove-all-err")
 			}
 
-			err := stemcell.Delete()
+			err := stemcell.Delete(func() error { return nil })
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("fake-remove-all-err"))
 		})
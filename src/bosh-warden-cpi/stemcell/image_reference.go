@@ -0,0 +1,85 @@
+package stemcell
+
+import (
+	"regexp"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+var sha256DigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ImageReference is an OCI image reference such as
+// ghcr.io/org/image:tag or ghcr.io/org/image@sha256:<hex>
+type ImageReference struct {
+	Name   string // includes registry host, e.g. ghcr.io/org/image
+	Tag    string
+	Digest string // e.g. sha256:<hex>
+}
+
+func ParseImageReference(ref string) (ImageReference, error) {
+	var imageRef ImageReference
+
+	nameAndTag := ref
+
+	if i := strings.Index(ref, "@"); i >= 0 {
+		nameAndTag = ref[:i]
+		imageRef.Digest = ref[i+1:]
+
+		err := ValidateDigest(imageRef.Digest)
+		if err != nil {
+			return ImageReference{}, err
+		}
+	}
+
+	imageRef.Name = nameAndTag
+
+	// Colon after last slash separates tag; earlier ones belong to registry port
+	if i := strings.LastIndex(nameAndTag, ":"); i > strings.LastIndex(nameAndTag, "/") {
+		imageRef.Name = nameAndTag[:i]
+		imageRef.Tag = nameAndTag[i+1:]
+
+		if imageRef.Tag == "" {
+			return ImageReference{}, bosherr.Errorf("Image reference '%s' has empty tag", ref)
+		}
+	}
+
+	if imageRef.Name == "" {
+		return ImageReference{}, bosherr.Errorf("Image reference '%s' has empty name", ref)
+	}
+
+	return imageRef, nil
+}
+
+// ValidateDigest checks that digest is a sha256 content digest
+func ValidateDigest(digest string) error {
+	if !sha256DigestRegexp.MatchString(digest) {
+		return bosherr.Errorf("Digest '%s' must be in 'sha256:<64 hex characters>' format", digest)
+	}
+
+	return nil
+}
+
+func (r ImageReference) String() string {
+	ref := r.Name
+
+	if r.Tag != "" {
+		ref += ":" + r.Tag
+	}
+
+	if r.Digest != "" {
+		ref += "@" + r.Digest
+	}
+
+	return ref
+}
+
+// Pinned returns reference that always resolves to the same image
+// when digest is known; tag is dropped since it is ignored anyway
+func (r ImageReference) Pinned() string {
+	if r.Digest == "" {
+		return r.String()
+	}
+
+	return r.Name + "@" + r.Digest
+}
@@ -0,0 +1,57 @@
+package stemcell_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+)
+
+var _ = Describe("ImageReference", func() {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	Describe("ParseImageReference", func() {
+		It("parses name and tag", func() {
+			ref, err := ParseImageReference("ghcr.io/org/image:1.2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal(ImageReference{Name: "ghcr.io/org/image", Tag: "1.2"}))
+		})
+
+		It("parses name, tag and digest", func() {
+			ref, err := ParseImageReference("ghcr.io/org/image:1.2@" + digest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal(ImageReference{Name: "ghcr.io/org/image", Tag: "1.2", Digest: digest}))
+			Expect(ref.String()).To(Equal("ghcr.io/org/image:1.2@" + digest))
+		})
+
+		It("does not mistake registry port for tag", func() {
+			ref, err := ParseImageReference("localhost:5000/image")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal(ImageReference{Name: "localhost:5000/image"}))
+		})
+
+		It("returns error for invalid digest", func() {
+			_, err := ParseImageReference("image@sha256:abc")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Digest 'sha256:abc' must be in 'sha256:<64 hex characters>' format"))
+		})
+
+		It("returns error for empty tag", func() {
+			_, err := ParseImageReference("image:")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("empty tag"))
+		})
+	})
+
+	Describe("Pinned", func() {
+		It("references image by digest without tag", func() {
+			ref := ImageReference{Name: "ghcr.io/org/image", Tag: "1.2", Digest: digest}
+			Expect(ref.Pinned()).To(Equal("ghcr.io/org/image@" + digest))
+		})
+
+		It("references image by tag when digest is unknown", func() {
+			ref := ImageReference{Name: "ghcr.io/org/image", Tag: "1.2"}
+			Expect(ref.Pinned()).To(Equal("ghcr.io/org/image:1.2"))
+		})
+	})
+})
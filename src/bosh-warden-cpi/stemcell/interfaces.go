@@ -16,5 +16,15 @@ type Stemcell interface {
 	ID() apiv1.StemcellCID
 	URI() string
 
-	Delete() error
+	// Metadata returns nil if stemcell has no recorded metadata
+	Metadata() (*Metadata, error)
+
+	// LockImage keeps image that containers use as their rootfs
+	// from being deleted until returned func is called
+	LockImage() (func(), error)
+
+	// Delete calls checkUnused right before removing image that
+	// containers use as their rootfs and keeps image if it fails;
+	// stemcells whose image is kept elsewhere never call it
+	Delete(checkUnused func() error) error
 }
@@ -1,16 +1,30 @@
 package stemcell
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
 )
 
 type LightImporter struct {
+	dirPath         string
+	hostArch        string
+	registryMirrors RegistryMirrors
+
+	// Resolves multi-platform images to host platform when set
+	imageResolver ImageResolver
+
+	// Pulls images at import time when set
+	imagePuller ImagePuller
+
 	fs             boshsys.FileSystem
+	uuidGen        boshuuid.Generator
 	metadataParser MetadataParser
 
 	logTag string
@@ -18,12 +32,24 @@ type LightImporter struct {
 }
 
 func NewLightImporter(
+	dirPath string,
+	hostArch string,
+	registryMirrors RegistryMirrors,
+	imageResolver ImageResolver,
+	imagePuller ImagePuller,
 	fs boshsys.FileSystem,
+	uuidGen boshuuid.Generator,
 	logger boshlog.Logger,
 ) LightImporter {
 	return LightImporter{
-		fs:             fs,
-		metadataParser: NewMetadataParser(fs),
+		dirPath:         dirPath,
+		hostArch:        hostArch,
+		registryMirrors: registryMirrors,
+		imageResolver:   imageResolver,
+		imagePuller:     imagePuller,
+		fs:              fs,
+		uuidGen:         uuidGen,
+		metadataParser:  NewMetadataParser(fs),
 
 		logTag: "LightImporter",
 		logger: logger,
@@ -52,13 +78,157 @@ func (i LightImporter) ImportFromPath(imagePath string) (Stemcell, error) {
 		return nil, bosherr.WrapError(err, "Validating image reference")
 	}
 
-	i.logger.Debug(i.logTag, "Light stemcell references image: %s", imageReference)
+	ref, err := i.pinImageReference(imageReference, metadata.GetDigest())
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Validating image digest")
+	}
+
+	if i.imageResolver != nil {
+		ref, err = i.resolvePlatform(ref)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Resolving image '%s' for host platform", ref)
+		}
+	}
+
+	i.logger.Debug(i.logTag, "Light stemcell references image: %s", ref)
+
+	var layoutPath string
+
+	if i.imagePuller != nil {
+		ref, layoutPath, err = i.prePull(ref)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Pre-pulling image '%s'", ref)
+		}
+	}
+
+	cid := apiv1.NewStemcellCID("light://" + ref.String())
+
+	err = i.fs.MkdirAll(i.dirPath, os.FileMode(0755))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating directory '%s'", i.dirPath)
+	}
+
+	err = newMetadataStore(LightStemcellLayoutPath(i.dirPath, cid), i.fs).Save(metadata)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Recording metadata of stemcell '%s'", cid)
+	}
+
+	i.logger.Debug(i.logTag, "Imported light stemcell '%s' with CID: %s", metadata, cid)
 
-	cid := "light://" + imageReference
+	// CID keeps original reference so that mirrors can be reconfigured later
+	return NewLightStemcell(
+		cid, i.registryMirrors.Rewrite(ref.String()), i.dirPath, layoutPath, i.fs, i.logger), nil
+}
 
-	i.logger.Debug(i.logTag, "Imported light stemcell with CID: %s", cid)
+// resolvePlatform pins reference to manifest of host architecture so that
+// multi-platform images do not resolve to other platforms when VMs are created
+func (i LightImporter) resolvePlatform(ref ImageReference) (ImageReference, error) {
+	resolveRef, err := ParseImageReference(i.registryMirrors.Rewrite(ref.String()))
+	if err != nil {
+		return ref, bosherr.WrapError(err, "Parsing mirrored image reference")
+	}
+
+	digest, err := i.imageResolver.Resolve(resolveRef, i.hostArch)
+	if err != nil {
+		// Registry may be unreachable from offline hosts; Garden then
+		// resolves platform itself when VMs are created as it did before
+		i.logger.Warn(i.logTag, "Keeping image '%s' unresolved since it could not be resolved for architecture '%s': %s",
+			ref, i.hostArch, err)
+
+		return ref, nil
+	}
+
+	if ref.Digest != digest {
+		i.logger.Debug(i.logTag, "Resolved image '%s' for architecture '%s' to '%s'", ref, i.hostArch, digest)
+	}
+
+	ref.Digest = digest
+
+	return ref, nil
+}
+
+// prePull stores image in stemcells directory so that creating VMs
+// does not depend on registry; references without digest get pinned to pulled one
+func (i LightImporter) prePull(ref ImageReference) (ImageReference, string, error) {
+	pullRef, err := ParseImageReference(i.registryMirrors.Rewrite(ref.String()))
+	if err != nil {
+		return ref, "", bosherr.WrapError(err, "Parsing mirrored image reference")
+	}
+
+	err = i.fs.MkdirAll(i.dirPath, os.FileMode(0755))
+	if err != nil {
+		return ref, "", bosherr.WrapErrorf(err, "Creating directory '%s'", i.dirPath)
+	}
+
+	id, err := i.uuidGen.Generate()
+	if err != nil {
+		return ref, "", bosherr.WrapError(err, "Generating staging directory id")
+	}
+
+	stagingPath := filepath.Join(i.dirPath, ".light-pull-"+id)
+
+	digest, err := i.imagePuller.Pull(pullRef, stagingPath)
+	if err != nil {
+		i.removeAll(stagingPath)
+		return ref, "", err
+	}
+
+	ref.Digest = digest
+
+	layoutPath := LightStemcellLayoutPath(i.dirPath, apiv1.NewStemcellCID("light://"+ref.String()))
+
+	if i.fs.FileExists(filepath.Join(layoutPath, ociLayoutFileName)) {
+		i.logger.Debug(i.logTag, "Image '%s' was already pulled to '%s'", ref, layoutPath)
+		i.removeAll(stagingPath)
+		return ref, layoutPath, nil
+	}
+
+	// Incomplete layout may be left behind by interrupted import
+	i.removeAll(layoutPath)
+
+	err = i.fs.Rename(stagingPath, layoutPath)
+	if err != nil {
+		i.removeAll(stagingPath)
+		return ref, "", bosherr.WrapErrorf(err, "Moving pulled image to '%s'", layoutPath)
+	}
+
+	return ref, layoutPath, nil
+}
+
+func (i LightImporter) removeAll(path string) {
+	err := i.fs.RemoveAll(path)
+	if err != nil {
+		i.logger.Error(i.logTag, "Failed to remove '%s': %s", path, err)
+	}
+}
+
+// pinImageReference adds digest from stemcell metadata to image reference;
+// digest already present in image reference must be the same digest
+func (i LightImporter) pinImageReference(imageReference, digest string) (ImageReference, error) {
+	ref, err := ParseImageReference(imageReference)
+	if err != nil {
+		return ImageReference{}, err
+	}
+
+	if digest != "" {
+		err = ValidateDigest(digest)
+		if err != nil {
+			return ImageReference{}, err
+		}
+
+		if ref.Digest != "" && ref.Digest != digest {
+			return ImageReference{}, bosherr.Errorf(
+				"Image reference digest '%s' does not match stemcell digest '%s'", ref.Digest, digest)
+		}
+
+		ref.Digest = digest
+	}
+
+	if ref.Digest == "" {
+		i.logger.Warn(i.logTag, "Light stemcell image '%s' is not pinned by digest", imageReference)
+	}
 
-	return NewLightStemcell(apiv1.NewStemcellCID(cid), imageReference, i.logger), nil
+	return ref, nil
 }
 
 func (i LightImporter) validateImageReference(imageRef string) error {
@@ -0,0 +1,231 @@
+package stemcell_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-utils/uuid/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+	"bosh-warden-cpi/stemcell/fakes"
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("LightImporter", func() {
+	const (
+		digest      = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		otherDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	)
+
+	var (
+		fs       *fakesys.FakeFileSystem
+		uuidGen  *fakeuuid.FakeGenerator
+		mirrors  RegistryMirrors
+		logger   boshlog.Logger
+		importer LightImporter
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-uuid"}
+		mirrors = RegistryMirrors{"mirrored.example.com/": "registry.local:5000/"}
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		importer = NewLightImporter("/fake-stemcells-dir", "amd64", mirrors, nil, nil, fs, uuidGen, logger)
+
+		err := fs.WriteFile("/fake-stemcell/image", []byte{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	writeMetadata := func(imageReference, digest string) {
+		err := fs.WriteFileString("/fake-stemcell/stemcell.MF", `---
+name: fake-name
+version: "1"
+stemcell_formats: [warden-light]
+cloud_properties:
+  image_reference: `+imageReference+`
+  digest: "`+digest+`"
+`)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("pins image reference by digest from stemcell metadata", func() {
+		writeMetadata("ghcr.io/org/image:1.2", digest)
+
+		stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stemcell.ID().AsString()).To(Equal("light://ghcr.io/org/image:1.2@" + digest))
+		Expect(stemcell.URI()).To(Equal("docker://ghcr.io/org/image@" + digest))
+	})
+
+	It("keeps digest that is part of image reference", func() {
+		writeMetadata("ghcr.io/org/image@"+digest, "")
+
+		stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stemcell.URI()).To(Equal("docker://ghcr.io/org/image@" + digest))
+	})
+
+	It("references image by tag when there is no digest", func() {
+		writeMetadata("ghcr.io/org/image:1.2", "")
+
+		stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stemcell.ID().AsString()).To(Equal("light://ghcr.io/org/image:1.2"))
+		Expect(stemcell.URI()).To(Equal("docker://ghcr.io/org/image:1.2"))
+	})
+
+	It("pulls image from mirror but keeps original reference in CID", func() {
+		writeMetadata("mirrored.example.com/org/image:1.2", digest)
+
+		stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stemcell.ID().AsString()).To(Equal("light://mirrored.example.com/org/image:1.2@" + digest))
+		Expect(stemcell.URI()).To(Equal("docker://registry.local:5000/org/image@" + digest))
+	})
+
+	It("records stemcell metadata until stemcell is deleted", func() {
+		writeMetadata("ghcr.io/org/image:1.2", digest)
+
+		stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).ToNot(HaveOccurred())
+
+		metadata, err := stemcell.Metadata()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata.String()).To(Equal("fake-name/1"))
+		Expect(metadata.GetImageReference()).To(Equal("ghcr.io/org/image:1.2"))
+
+		found, _, err := NewCompositeFinder("/fake-stemcells-dir", mirrors, util.NewRecordingNoopLocker(), fs, logger).Find(stemcell.ID())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found.Metadata()).To(Equal(metadata))
+
+		err = stemcell.Delete(func() error { return nil })
+		Expect(err).ToNot(HaveOccurred())
+
+		metadata, err = stemcell.Metadata()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata).To(BeNil())
+	})
+
+	It("returns error if digest is invalid", func() {
+		writeMetadata("ghcr.io/org/image:1.2", "sha256:abc")
+
+		_, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Digest 'sha256:abc' must be in 'sha256:<64 hex characters>' format"))
+	})
+
+	It("returns error if digest does not match digest in image reference", func() {
+		writeMetadata("ghcr.io/org/image@"+otherDigest, digest)
+
+		_, err := importer.ImportFromPath("/fake-stemcell/image")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not match stemcell digest"))
+	})
+
+	Context("when pre-pulling images", func() {
+		var (
+			puller     *fakes.FakeImagePuller
+			layoutPath string
+		)
+
+		BeforeEach(func() {
+			puller = &fakes.FakeImagePuller{
+				PullDigest: digest,
+				PullCallback: func(dstDir string) {
+					err := fs.WriteFileString(dstDir+"/oci-layout", "{}")
+					Expect(err).ToNot(HaveOccurred())
+				},
+			}
+			importer = NewLightImporter("/fake-stemcells-dir", "amd64", mirrors, nil, puller, fs, uuidGen, logger)
+
+			layoutPath = LightStemcellLayoutPath(
+				"/fake-stemcells-dir", apiv1.NewStemcellCID("light://mirrored.example.com/org/image:1.2@"+digest))
+		})
+
+		It("pulls image from mirror into stemcells directory and pins reference to pulled digest", func() {
+			writeMetadata("mirrored.example.com/org/image:1.2", "")
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(puller.PullRef).To(Equal(ImageReference{Name: "registry.local:5000/org/image", Tag: "1.2"}))
+			Expect(puller.PullDstDir).To(Equal("/fake-stemcells-dir/.light-pull-fake-uuid"))
+
+			Expect(stemcell.ID().AsString()).To(Equal("light://mirrored.example.com/org/image:1.2@" + digest))
+			Expect(stemcell.URI()).To(Equal("oci://" + layoutPath))
+
+			Expect(fs.FileExists(layoutPath + "/oci-layout")).To(BeTrue())
+			Expect(fs.FileExists("/fake-stemcells-dir/.light-pull-fake-uuid")).To(BeFalse())
+		})
+
+		It("removes pre-pulled image when stemcell is deleted", func() {
+			writeMetadata("mirrored.example.com/org/image:1.2", digest)
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = stemcell.Delete(func() error { return nil })
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fs.FileExists(layoutPath)).To(BeFalse())
+		})
+
+		It("returns error and cleans up if pulling image fails", func() {
+			writeMetadata("mirrored.example.com/org/image:1.2", digest)
+			puller.PullErr = errors.New("fake-pull-err")
+
+			_, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-pull-err"))
+
+			Expect(fs.FileExists("/fake-stemcells-dir/.light-pull-fake-uuid")).To(BeFalse())
+		})
+	})
+
+	Context("when resolving images for host platform", func() {
+		var resolver *fakes.FakeImageResolver
+
+		BeforeEach(func() {
+			resolver = &fakes.FakeImageResolver{ResolveDigest: otherDigest}
+			importer = NewLightImporter("/fake-stemcells-dir", "arm64", mirrors, resolver, nil, fs, uuidGen, logger)
+		})
+
+		It("pins reference to manifest digest of host architecture", func() {
+			writeMetadata("mirrored.example.com/org/image:1.2", digest)
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resolver.ResolveRef).To(Equal(ImageReference{
+				Name: "registry.local:5000/org/image", Tag: "1.2", Digest: digest}))
+			Expect(resolver.ResolveArch).To(Equal("arm64"))
+
+			Expect(stemcell.ID().AsString()).To(Equal("light://mirrored.example.com/org/image:1.2@" + otherDigest))
+			Expect(stemcell.URI()).To(Equal("docker://registry.local:5000/org/image@" + otherDigest))
+		})
+
+		It("keeps stemcell digest if image cannot be resolved", func() {
+			writeMetadata("mirrored.example.com/org/image:1.2", digest)
+			resolver.ResolveErr = errors.New("fake-resolve-err")
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stemcell.ID().AsString()).To(Equal("light://mirrored.example.com/org/image:1.2@" + digest))
+		})
+
+		It("keeps image without digest unresolved if it cannot be resolved", func() {
+			writeMetadata("mirrored.example.com/org/image:1.2", "")
+			resolver.ResolveErr = errors.New("fake-resolve-err")
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stemcell.ID().AsString()).To(Equal("light://mirrored.example.com/org/image:1.2"))
+			Expect(stemcell.URI()).To(Equal("docker://registry.local:5000/org/image:1.2"))
+		})
+	})
+})
@@ -1,14 +1,27 @@
 package stemcell
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
 )
 
 type LightStemcell struct {
 	cid            apiv1.StemcellCID
 	imageReference string
 
+	// Metadata is kept in stemcells directory even when image is pulled by Garden
+	dirPath string
+
+	// Image layout with pre-pulled image; empty when image is pulled by Garden
+	layoutPath string
+
+	fs     boshsys.FileSystem
 	logTag string
 	logger boshlog.Logger
 }
@@ -16,24 +29,63 @@ type LightStemcell struct {
 func NewLightStemcell(
 	cid apiv1.StemcellCID,
 	imageReference string,
+	dirPath string,
+	layoutPath string,
+	fs boshsys.FileSystem,
 	logger boshlog.Logger,
 ) LightStemcell {
 	return LightStemcell{
 		cid:            cid,
 		imageReference: imageReference,
+		dirPath:        dirPath,
+		layoutPath:     layoutPath,
 
+		fs:     fs,
 		logTag: "LightStemcell",
 		logger: logger,
 	}
 }
 
+// LightStemcellLayoutPath returns where pre-pulled image of light stemcell is kept
+func LightStemcellLayoutPath(dirPath string, cid apiv1.StemcellCID) string {
+	sum := sha1.Sum([]byte(cid.AsString()))
+	return filepath.Join(dirPath, "light-"+hex.EncodeToString(sum[:]))
+}
+
 func (s LightStemcell) ID() apiv1.StemcellCID { return s.cid }
 
+// URI references image by digest when it is known so that
+// re-tagging the image does not change what new VMs run
 func (s LightStemcell) URI() string {
-	return "docker://" + s.imageReference
+	if s.layoutPath != "" {
+		return "oci://" + s.layoutPath
+	}
+
+	ref, err := ParseImageReference(s.imageReference)
+	if err != nil {
+		return "docker://" + s.imageReference
+	}
+
+	return "docker://" + ref.Pinned()
+}
+
+func (s LightStemcell) Metadata() (*Metadata, error) {
+	return newMetadataStore(LightStemcellLayoutPath(s.dirPath, s.cid), s.fs).Load()
 }
 
-func (s LightStemcell) Delete() error {
+func (s LightStemcell) LockImage() (func(), error) { return func() {}, nil }
+
+// Delete never checks whether stemcell is unused since
+// Garden keeps images of light stemcells in its own store
+func (s LightStemcell) Delete(_ func() error) error {
 	s.logger.Debug(s.logTag, "Delete light stemcell '%s'", s.cid)
-	return nil
+
+	if s.layoutPath != "" {
+		err := s.fs.RemoveAll(s.layoutPath)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Deleting pre-pulled image '%s'", s.layoutPath)
+		}
+	}
+
+	return newMetadataStore(LightStemcellLayoutPath(s.dirPath, s.cid), s.fs).Delete()
 }
@@ -12,11 +12,19 @@ import (
 	"go.yaml.in/yaml/v3"
 )
 
-// Metadata represents the metadata for a light stemcell
+const (
+	// OCI stemcells keep image in OCI image layout archive
+	// instead of root filesystem tarball
+	StemcellFormatWardenOCI = "warden-oci"
+)
+
+// Metadata represents the metadata for a stemcell
 type Metadata struct {
 	Name            string          `yaml:"name"`
 	Version         string          `yaml:"version"`
+	OperatingSystem string          `yaml:"operating_system"`
 	StemcellFormats []string        `yaml:"stemcell_formats"`
+	Sha1            string          `yaml:"sha1"`
 	CloudProperties CloudProperties `yaml:"cloud_properties"`
 }
 
@@ -24,6 +32,8 @@ type Metadata struct {
 type CloudProperties struct {
 	ImageReference string `yaml:"image_reference"`
 	Digest         string `yaml:"digest"`
+	Architecture   string `yaml:"architecture"`
+	InitSystem     string `yaml:"init_system"`
 }
 
 // IsLightStemcell returns true if this is a light stemcell
@@ -37,6 +47,21 @@ func (m *Metadata) IsLightStemcell() bool {
 	return false
 }
 
+// IsOCIStemcell returns true if stemcell image is an OCI image layout archive
+func (m *Metadata) IsOCIStemcell() bool {
+	for _, format := range m.StemcellFormats {
+		if format == StemcellFormatWardenOCI {
+			return true
+		}
+	}
+	return false
+}
+
+// String identifies stemcell for humans, e.g. bosh-warden-boshlite-ubuntu-jammy-go_agent/1.2
+func (m *Metadata) String() string {
+	return m.Name + "/" + m.Version
+}
+
 // GetImageReference returns the OCI image reference from metadata
 func (m *Metadata) GetImageReference() string {
 	return m.CloudProperties.ImageReference
@@ -47,6 +72,16 @@ func (m *Metadata) GetDigest() string {
 	return m.CloudProperties.Digest
 }
 
+// GetArchitecture returns architecture of stemcell image (e.g. x86_64) if specified
+func (m *Metadata) GetArchitecture() string {
+	return m.CloudProperties.Architecture
+}
+
+// GetInitSystem returns init system (e.g. systemd) that containers of stemcell must be started with if specified
+func (m *Metadata) GetInitSystem() string {
+	return m.CloudProperties.InitSystem
+}
+
 // MetadataParser handles parsing stemcell metadata
 type MetadataParser struct {
 	fs boshsys.FileSystem
@@ -58,7 +93,8 @@ func NewMetadataParser(fs boshsys.FileSystem) MetadataParser {
 }
 
 // ParseFromPath parses stemcell metadata from a path
-// Returns metadata and true if it's a light stemcell, or nil and false if it's a traditional stemcell
+// Returns metadata and true if it's a light stemcell, metadata and false if it's another
+// stemcell that includes metadata, or nil and false if it's a traditional stemcell without it
 // The path can be either:
 // - A path to an 'image' file (BOSH Director extracts stemcells and passes the path to the image file)
 // - A directory containing the extracted stemcell
@@ -110,7 +146,7 @@ func (p MetadataParser) parseFromDirectory(dirPath string) (*Metadata, bool, err
 			}
 
 			// Has metadata but not a light stemcell
-			return nil, false, nil
+			return &metadata, false, nil
 		}
 	}
 
@@ -163,7 +199,7 @@ func (p MetadataParser) parseFromArchive(archivePath string) (*Metadata, bool, e
 			}
 
 			// Has metadata but not a light stemcell
-			return nil, false, nil
+			return &metadata, false, nil
 		}
 	}
 
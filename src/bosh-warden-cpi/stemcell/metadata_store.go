@@ -0,0 +1,66 @@
+package stemcell
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	"go.yaml.in/yaml/v3"
+)
+
+// metadataStore keeps stemcell metadata recorded at import time
+// next to the stemcell in <path>.metadata.yml
+type metadataStore struct {
+	path string
+	fs   boshsys.FileSystem
+}
+
+func newMetadataStore(stemcellPath string, fs boshsys.FileSystem) metadataStore {
+	return metadataStore{path: stemcellPath + ".metadata.yml", fs: fs}
+}
+
+func (s metadataStore) Save(metadata *Metadata) error {
+	if metadata == nil {
+		return nil
+	}
+
+	contents, err := yaml.Marshal(metadata)
+	if err != nil {
+		return bosherr.WrapError(err, "Marshaling stemcell metadata")
+	}
+
+	err = s.fs.WriteFile(s.path, contents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing stemcell metadata '%s'", s.path)
+	}
+
+	return nil
+}
+
+// Load returns nil if stemcell had no metadata or was imported before metadata was recorded
+func (s metadataStore) Load() (*Metadata, error) {
+	if !s.fs.FileExists(s.path) {
+		return nil, nil
+	}
+
+	contents, err := s.fs.ReadFile(s.path)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading stemcell metadata '%s'", s.path)
+	}
+
+	var metadata Metadata
+
+	err = yaml.Unmarshal(contents, &metadata)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Unmarshaling stemcell metadata '%s'", s.path)
+	}
+
+	return &metadata, nil
+}
+
+func (s metadataStore) Delete() error {
+	err := s.fs.RemoveAll(s.path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing stemcell metadata '%s'", s.path)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package stemcell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+
+	"bosh-warden-cpi/util"
+)
+
+type OCIImporter struct {
+	dirPath string
+
+	fs             boshsys.FileSystem
+	uuidGen        boshuuid.Generator
+	decompressor   util.Decompressor
+	metadataParser MetadataParser
+
+	logTag string
+	logger boshlog.Logger
+}
+
+// NewOCIImporter expects decompressor that unpacks (optionally compressed)
+// tar archives since image layouts are always directories
+func NewOCIImporter(
+	dirPath string,
+	fs boshsys.FileSystem,
+	uuidGen boshuuid.Generator,
+	decompressor util.Decompressor,
+	logger boshlog.Logger,
+) OCIImporter {
+	return OCIImporter{
+		dirPath: dirPath,
+
+		fs:             fs,
+		uuidGen:        uuidGen,
+		decompressor:   decompressor,
+		metadataParser: NewMetadataParser(fs),
+
+		logTag: "OCIImporter",
+		logger: logger,
+	}
+}
+
+func (i OCIImporter) ImportFromPath(imagePath string) (Stemcell, error) {
+	i.logger.Debug(i.logTag, "Importing OCI stemcell from path '%s'", imagePath)
+
+	metadata, _, err := i.metadataParser.ParseFromPath(imagePath)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Parsing stemcell metadata")
+	}
+
+	id, err := i.uuidGen.Generate()
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating stemcell id")
+	}
+
+	err = i.fs.MkdirAll(i.dirPath, os.FileMode(0755))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating directory '%s'", i.dirPath)
+	}
+
+	stemcellPath := filepath.Join(i.dirPath, id)
+
+	// Image layout is unpacked into staging directory first and is only moved
+	// into place once complete since oci-layout file alone marks it as stemcell
+	stagingPath := filepath.Join(i.dirPath, fmt.Sprintf("%s%d-%s", stagingDirPrefix, os.Getpid(), id))
+
+	err = i.decompressor.Decompress(imagePath, stagingPath)
+	if err != nil {
+		i.cleanUp(stagingPath)
+		return nil, bosherr.WrapErrorf(err, "Unpacking OCI image layout '%s' to '%s'", imagePath, stagingPath)
+	}
+
+	if !i.fs.FileExists(filepath.Join(stagingPath, ociLayoutFileName)) {
+		i.cleanUp(stagingPath)
+		return nil, bosherr.Errorf("Stemcell image '%s' is not an OCI image layout: missing '%s' file", imagePath, ociLayoutFileName)
+	}
+
+	metadataStore := newMetadataStore(stemcellPath, i.fs)
+
+	err = metadataStore.Save(metadata)
+	if err != nil {
+		i.cleanUp(stagingPath)
+		return nil, bosherr.WrapErrorf(err, "Recording metadata of stemcell '%s'", id)
+	}
+
+	err = i.fs.Rename(stagingPath, stemcellPath)
+	if err != nil {
+		i.cleanUp(stagingPath)
+
+		deleteErr := metadataStore.Delete()
+		if deleteErr != nil {
+			i.logger.Error(i.logTag, "Failed to delete metadata of stemcell '%s': %s", id, deleteErr)
+		}
+
+		return nil, bosherr.WrapErrorf(err, "Moving unpacked OCI image layout to '%s'", stemcellPath)
+	}
+
+	i.logger.Debug(i.logTag, "Imported OCI stemcell from path '%s'", imagePath)
+
+	return NewOCIStemcell(apiv1.NewStemcellCID(id), stemcellPath, i.fs, i.logger), nil
+}
+
+func (i OCIImporter) cleanUp(stagingPath string) {
+	err := i.fs.RemoveAll(stagingPath)
+	if err != nil {
+		i.logger.Error(i.logTag, "Failed to clean up staging directory '%s': %s", stagingPath, err)
+	}
+}
@@ -0,0 +1,137 @@
+package stemcell_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-utils/uuid/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+	"bosh-warden-cpi/stemcell/fakes"
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("OCIImporter", func() {
+	var (
+		fs           *fakesys.FakeFileSystem
+		uuidGen      *fakeuuid.FakeGenerator
+		decompressor *fakes.FakeDecompressor
+		logger       boshlog.Logger
+		importer     OCIImporter
+		stagingPath  string
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		uuidGen = &fakeuuid.FakeGenerator{GeneratedUUID: "fake-uuid"}
+		decompressor = &fakes.FakeDecompressor{
+			DecompressCallback: func(_, dst string) {
+				err := fs.WriteFileString(dst+"/oci-layout", `{"imageLayoutVersion":"1.0.0"}`)
+				Expect(err).ToNot(HaveOccurred())
+			},
+		}
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		importer = NewOCIImporter("/fake-collection-dir", fs, uuidGen, decompressor, logger)
+		stagingPath = fmt.Sprintf("/fake-collection-dir/.staging-%d-fake-uuid", os.Getpid())
+
+		err := fs.WriteFileString("/fake-image-path", "fake-image-contents")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("ImportFromPath", func() {
+		It("unpacks image layout into stemcells directory and returns stemcell with local OCI URI", func() {
+			stemcell, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(decompressor.DecompressSrcForCall).To(Equal([]string{"/fake-image-path"}))
+			Expect(decompressor.DecompressDstForCall).To(Equal([]string{stagingPath}))
+
+			Expect(fs.FileExists("/fake-collection-dir/fake-uuid/oci-layout")).To(BeTrue())
+			Expect(fs.FileExists(stagingPath)).To(BeFalse())
+
+			Expect(stemcell.ID()).To(Equal(apiv1.NewStemcellCID("fake-uuid")))
+			Expect(stemcell.URI()).To(Equal("oci:///fake-collection-dir/fake-uuid"))
+		})
+
+		It("records stemcell metadata", func() {
+			err := fs.WriteFileString("/fake-stemcell/image", "fake-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF", `---
+name: fake-name
+version: "1.2"
+operating_system: ubuntu-jammy
+stemcell_formats: [warden-oci]
+`)
+			Expect(err).ToNot(HaveOccurred())
+
+			stemcell, err := importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).ToNot(HaveOccurred())
+
+			metadata, err := stemcell.Metadata()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata.Name).To(Equal("fake-name"))
+			Expect(metadata.Version).To(Equal("1.2"))
+			Expect(metadata.OperatingSystem).To(Equal("ubuntu-jammy"))
+			Expect(metadata.StemcellFormats).To(Equal([]string{"warden-oci"}))
+
+			Expect(fs.FileExists("/fake-collection-dir/fake-uuid.metadata.yml")).To(BeTrue())
+		})
+
+		It("returns error and cleans up if image is not an OCI image layout", func() {
+			decompressor.DecompressCallback = func(_, dst string) {
+				err := fs.WriteFileString(dst+"/rootfs.tar", "")
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			stemcell, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not an OCI image layout"))
+			Expect(stemcell).To(BeNil())
+
+			Expect(fs.FileExists("/fake-collection-dir/fake-uuid")).To(BeFalse())
+			Expect(fs.FileExists(stagingPath)).To(BeFalse())
+		})
+
+		It("returns error and leaves no stemcell directory if unpacking image layout fails", func() {
+			// oci-layout is written before unpacking is interrupted
+			decompressor.DecompressError = errors.New("fake-decompress-error")
+
+			stemcell, err := importer.ImportFromPath("/fake-image-path")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-decompress-error"))
+			Expect(stemcell).To(BeNil())
+
+			Expect(fs.FileExists("/fake-collection-dir/fake-uuid")).To(BeFalse())
+			Expect(fs.FileExists(stagingPath)).To(BeFalse())
+
+			_, found, err := NewCompositeFinder(
+				"/fake-collection-dir", nil, util.NewRecordingNoopLocker(), fs, logger).Find(apiv1.NewStemcellCID("fake-uuid"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("returns error and removes metadata if moving image layout into place fails", func() {
+			err := fs.WriteFileString("/fake-stemcell/image", "fake-image-contents")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileString("/fake-stemcell/stemcell.MF", "---\nname: fake-name\nstemcell_formats: [warden-oci]\n")
+			Expect(err).ToNot(HaveOccurred())
+
+			fs.RenameError = errors.New("fake-rename-err")
+
+			_, err = importer.ImportFromPath("/fake-stemcell/image")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-rename-err"))
+
+			Expect(fs.FileExists(stagingPath)).To(BeFalse())
+			Expect(fs.FileExists("/fake-collection-dir/fake-uuid.metadata.yml")).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package stemcell
+
+import (
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// ociLayoutFileName marks root of OCI image layout directory
+const ociLayoutFileName = "oci-layout"
+
+type OCIStemcell struct {
+	id      apiv1.StemcellCID
+	dirPath string
+
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewOCIStemcell(
+	id apiv1.StemcellCID,
+	dirPath string,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) OCIStemcell {
+	return OCIStemcell{id: id, dirPath: dirPath, fs: fs, logger: logger}
+}
+
+func (s OCIStemcell) ID() apiv1.StemcellCID { return s.id }
+
+// URI points Garden at unpacked image layout so that no registry is needed
+func (s OCIStemcell) URI() string { return "oci://" + s.dirPath }
+
+func (s OCIStemcell) Metadata() (*Metadata, error) {
+	return newMetadataStore(s.dirPath, s.fs).Load()
+}
+
+func (s OCIStemcell) LockImage() (func(), error) { return func() {}, nil }
+
+func (s OCIStemcell) Delete(checkUnused func() error) error {
+	s.logger.Debug("OCIStemcell", "Deleting stemcell '%s'", s.id)
+
+	err := checkUnused()
+	if err != nil {
+		return err
+	}
+
+	err = s.fs.RemoveAll(s.dirPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting stemcell directory '%s'", s.dirPath)
+	}
+
+	return newMetadataStore(s.dirPath, s.fs).Delete()
+}
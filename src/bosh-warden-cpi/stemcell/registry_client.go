@@ -0,0 +1,563 @@
+package stemcell
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+
+	"bosh-warden-cpi/config"
+)
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// Docker Hub API is not served from docker.io itself
+	defaultRegistryAPIHost = "registry-1.docker.io"
+
+	// Unreachable registries must not hang CPI; bodies of large blobs
+	// are not limited since their download time depends on their size
+	registryConnectTimeout  = 10 * time.Second
+	registryResponseTimeout = 30 * time.Second
+)
+
+type ImageResolver interface {
+	// Resolve returns digest of image manifest for given architecture,
+	// picking platform-specific manifest out of multi-platform indexes
+	Resolve(ref ImageReference, arch string) (string, error)
+}
+
+type ImagePuller interface {
+	// Pull stores image in OCI image layout at dstDir and returns its manifest digest
+	Pull(ref ImageReference, dstDir string) (string, error)
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// RegistryClient pulls images with Docker Registry HTTP API V2
+type RegistryClient struct {
+	httpClient  *http.Client
+	credentials map[string]config.RegistryCredentials
+	fs          boshsys.FileSystem
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func NewRegistryClient(
+	httpClient *http.Client,
+	credentials map[string]config.RegistryCredentials,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) RegistryClient {
+	return RegistryClient{
+		httpClient:  httpClient,
+		credentials: credentials,
+		fs:          fs,
+
+		logTag: "RegistryClient",
+		logger: logger,
+	}
+}
+
+// NewRegistryHTTPClient returns client that gives up on registries
+// that cannot be reached or do not respond
+func NewRegistryHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: registryConnectTimeout}).DialContext
+	transport.TLSHandshakeTimeout = registryConnectTimeout
+	transport.ResponseHeaderTimeout = registryResponseTimeout
+
+	return &http.Client{Transport: transport}
+}
+
+func (c RegistryClient) Pull(ref ImageReference, dstDir string) (string, error) {
+	repo := newRegistryRepo(ref, c.credentials, c.httpClient)
+
+	c.logger.Debug(c.logTag, "Pulling image '%s' from '%s'", ref, repo.baseURL)
+
+	manifestBytes, mediaType, manifest, err := c.fetchManifest(repo, ref)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256Digest(manifestBytes)
+
+	if isIndexMediaType(mediaType) {
+		return "", bosherr.Errorf("Image '%s' is a multi-platform index; pre-pulling requires platform-specific image", ref)
+	}
+
+	err = c.fs.MkdirAll(filepath.Join(dstDir, "blobs", "sha256"), os.FileMode(0755))
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Creating image layout directory '%s'", dstDir)
+	}
+
+	for _, desc := range append([]ociDescriptor{manifest.Config}, manifest.Layers...) {
+		err = c.pullBlob(repo, desc, dstDir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	manifestDesc := ociDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(manifestBytes))}
+
+	err = c.writeLayout(dstDir, manifestDesc, manifestBytes, ref.Tag)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Writing image layout '%s'", dstDir)
+	}
+
+	c.logger.Debug(c.logTag, "Pulled image '%s' with digest '%s'", ref, digest)
+
+	return digest, nil
+}
+
+func (c RegistryClient) Resolve(ref ImageReference, arch string) (string, error) {
+	repo := newRegistryRepo(ref, c.credentials, c.httpClient)
+
+	c.logger.Debug(c.logTag, "Resolving image '%s' for architecture '%s'", ref, arch)
+
+	manifestBytes, mediaType, manifest, err := c.fetchManifest(repo, ref)
+	if err != nil {
+		return "", err
+	}
+
+	if !isIndexMediaType(mediaType) {
+		return sha256Digest(manifestBytes), nil
+	}
+
+	var available []string
+
+	for _, desc := range manifest.Manifests {
+		if desc.Platform == nil {
+			continue
+		}
+
+		if desc.Platform.OS == "linux" && NormalizeArchitecture(desc.Platform.Architecture) == arch {
+			err = ValidateDigest(desc.Digest)
+			if err != nil {
+				return "", bosherr.WrapErrorf(err, "Validating manifest digest for platform of image '%s'", ref)
+			}
+
+			c.logger.Debug(c.logTag, "Resolved image '%s' to '%s'", ref, desc.Digest)
+
+			return desc.Digest, nil
+		}
+
+		available = append(available, desc.Platform.OS+"/"+desc.Platform.Architecture)
+	}
+
+	return "", bosherr.Errorf("Image '%s' has no manifest for platform 'linux/%s'; available platforms: %s",
+		ref, arch, strings.Join(available, ", "))
+}
+
+// fetchManifest fetches manifest by digest (verifying it) or by tag
+func (c RegistryClient) fetchManifest(repo registryRepo, ref ImageReference) ([]byte, string, ociManifest, error) {
+	var manifest ociManifest
+
+	manifestRef := ref.Digest
+	if manifestRef == "" {
+		manifestRef = ref.Tag
+	}
+	if manifestRef == "" {
+		manifestRef = "latest"
+	}
+
+	manifestBytes, mediaType, err := repo.fetchManifest(manifestRef)
+	if err != nil {
+		return nil, "", manifest, bosherr.WrapErrorf(err, "Fetching manifest of image '%s'", ref)
+	}
+
+	if digest := sha256Digest(manifestBytes); ref.Digest != "" && ref.Digest != digest {
+		return nil, "", manifest, bosherr.Errorf("Manifest of image '%s' has digest '%s'", ref, digest)
+	}
+
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, "", manifest, bosherr.WrapErrorf(err, "Unmarshalling manifest of image '%s'", ref)
+	}
+
+	// Some registries serve manifests as plain JSON
+	if mediaType == "" || mediaType == "application/json" {
+		mediaType = manifest.MediaType
+	}
+	if mediaType == "" {
+		mediaType = mediaTypeOCIManifest
+	}
+
+	return manifestBytes, mediaType, manifest, nil
+}
+
+func isIndexMediaType(mediaType string) bool {
+	return mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList
+}
+
+func (c RegistryClient) pullBlob(repo registryRepo, desc ociDescriptor, dstDir string) error {
+	err := ValidateDigest(desc.Digest)
+	if err != nil {
+		return bosherr.WrapError(err, "Validating blob digest")
+	}
+
+	c.logger.Debug(c.logTag, "Pulling blob '%s' (%d bytes)", desc.Digest, desc.Size)
+
+	resp, err := repo.get("/blobs/"+desc.Digest, "")
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Fetching blob '%s'", desc.Digest)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	blobPath := blobPath(dstDir, desc.Digest)
+
+	// Blob is only renamed into place once fully written and verified
+	partialPath := blobPath + ".partial"
+
+	err = c.downloadBlob(resp.Body, partialPath, desc.Digest)
+	if err != nil {
+		c.removePartialBlob(partialPath)
+		return err
+	}
+
+	err = c.fs.Rename(partialPath, blobPath)
+	if err != nil {
+		c.removePartialBlob(partialPath)
+		return bosherr.WrapErrorf(err, "Moving blob '%s' into place", desc.Digest)
+	}
+
+	return nil
+}
+
+func (c RegistryClient) removePartialBlob(path string) {
+	err := c.fs.RemoveAll(path)
+	if err != nil {
+		c.logger.Error(c.logTag, "Failed to remove partial blob '%s': %s", path, err)
+	}
+}
+
+func (c RegistryClient) downloadBlob(body io.Reader, path, digest string) error {
+	file, err := c.fs.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0644))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating blob file '%s'", path)
+	}
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(file, hash), body)
+	if err != nil {
+		file.Close() //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Downloading blob '%s'", digest)
+	}
+
+	// Closing reports deferred write errors, e.g. running out of space
+	err = file.Close()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Closing blob file '%s'", path)
+	}
+
+	if actual := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		return bosherr.Errorf("Downloaded blob '%s' has digest '%s'", digest, actual)
+	}
+
+	return nil
+}
+
+func (c RegistryClient) writeLayout(dstDir string, manifestDesc ociDescriptor, manifestBytes []byte, tag string) error {
+	err := c.fs.WriteFile(blobPath(dstDir, manifestDesc.Digest), manifestBytes)
+	if err != nil {
+		return err
+	}
+
+	if tag != "" {
+		manifestDesc.Annotations = map[string]string{"org.opencontainers.image.ref.name": tag}
+	}
+
+	indexBytes, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests":     []ociDescriptor{manifestDesc},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.fs.WriteFile(filepath.Join(dstDir, "index.json"), indexBytes)
+	if err != nil {
+		return err
+	}
+
+	// Written last since it marks directory as complete image layout
+	return c.fs.WriteFileString(filepath.Join(dstDir, ociLayoutFileName), `{"imageLayoutVersion":"1.0.0"}`)
+}
+
+func blobPath(dstDir, digest string) string {
+	return filepath.Join(dstDir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+func sha256Digest(bytes []byte) string {
+	sum := sha256.Sum256(bytes)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// registryRepo issues requests against single repository
+// authenticating with basic or bearer token auth as challenged
+type registryRepo struct {
+	baseURL    string
+	repoName   string
+	creds      *config.RegistryCredentials
+	httpClient *http.Client
+
+	// Shared between copies so that token is only fetched once per pull
+	authHeader *string
+}
+
+// FindRegistryCredentials returns credentials of registry hosting image;
+// references without registry host are hosted by Docker Hub whose
+// credentials may be keyed by either docker.io or its API host
+func FindRegistryCredentials(
+	credentials map[string]config.RegistryCredentials,
+	imageReference string,
+) (config.RegistryCredentials, bool) {
+	host, _, _ := strings.Cut(qualifyImageReference(imageReference), "/")
+
+	if creds, found := credentials[host]; found {
+		return creds, true
+	}
+
+	if host == defaultRegistryHost {
+		creds, found := credentials[defaultRegistryAPIHost]
+		return creds, found
+	}
+
+	return config.RegistryCredentials{}, false
+}
+
+func newRegistryRepo(
+	ref ImageReference,
+	credentials map[string]config.RegistryCredentials,
+	httpClient *http.Client,
+) registryRepo {
+	qualifiedName := qualifyImageReference(ref.Name)
+	host, repoName, _ := strings.Cut(qualifiedName, "/")
+
+	repo := registryRepo{
+		repoName:   repoName,
+		httpClient: httpClient,
+		authHeader: new(string),
+	}
+
+	if creds, found := FindRegistryCredentials(credentials, ref.Name); found {
+		repo.creds = &creds
+	}
+
+	if host == defaultRegistryHost {
+		host = defaultRegistryAPIHost
+	}
+
+	repo.baseURL = "https://" + host
+
+	return repo
+}
+
+func (r registryRepo) fetchManifest(reference string) ([]byte, string, error) {
+	accept := strings.Join([]string{
+		mediaTypeOCIManifest, mediaTypeOCIIndex, mediaTypeDockerManifest, mediaTypeDockerList}, ", ")
+
+	resp, err := r.get("/manifests/"+reference, accept)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	bytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", bosherr.WrapError(err, "Reading manifest")
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+
+	return bytes, mediaType, nil
+}
+
+func (r registryRepo) get(path, accept string) (*http.Response, error) {
+	url := r.baseURL + "/v2/" + r.repoName + path
+
+	resp, err := r.do(url, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close() //nolint:errcheck
+
+		err = r.authenticate(challenge)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Authenticating to '%s'", r.baseURL)
+		}
+
+		resp, err = r.do(url, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close() //nolint:errcheck
+		return nil, bosherr.Errorf("Registry responded to 'GET %s' with status '%s'", url, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (r registryRepo) do(url, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Building request for '%s'", url)
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if *r.authHeader != "" {
+		req.Header.Set("Authorization", *r.authHeader)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Requesting '%s'", url)
+	}
+
+	return resp, nil
+}
+
+func (r registryRepo) authenticate(challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.creds == nil {
+			return bosherr.Error("Registry requires credentials but none are configured")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(r.creds.Username, r.creds.Password)
+		*r.authHeader = req.Header.Get("Authorization")
+
+		return nil
+
+	case "bearer":
+		return r.fetchToken(params)
+
+	default:
+		return bosherr.Errorf("Unsupported authentication challenge '%s'", challenge)
+	}
+}
+
+func (r registryRepo) fetchToken(params map[string]string) error {
+	realm := params["realm"]
+	if realm == "" {
+		return bosherr.Error("Bearer challenge is missing realm")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, realm, nil)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Building token request for '%s'", realm)
+	}
+
+	query := req.URL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", r.repoName))
+	req.URL.RawQuery = query.Encode()
+
+	if r.creds != nil {
+		req.SetBasicAuth(r.creds.Username, r.creds.Password)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Requesting token from '%s'", realm)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return bosherr.Errorf("Token service '%s' responded with status '%s'", realm, resp.Status)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	if err != nil {
+		return bosherr.WrapError(err, "Unmarshalling token response")
+	}
+
+	token := tokenResp.Token
+	if token == "" {
+		token = tokenResp.AccessToken
+	}
+
+	*r.authHeader = "Bearer " + token
+
+	return nil
+}
+
+// parseAuthChallenge parses WWW-Authenticate header,
+// e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+
+	for rest != "" {
+		var key, value string
+
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+
+	return scheme, params
+}
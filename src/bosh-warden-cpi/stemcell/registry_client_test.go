@@ -0,0 +1,305 @@
+package stemcell_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"bosh-warden-cpi/config"
+	. "bosh-warden-cpi/stemcell"
+)
+
+var _ = Describe("FindRegistryCredentials", func() {
+	var credentials map[string]config.RegistryCredentials
+
+	BeforeEach(func() {
+		credentials = map[string]config.RegistryCredentials{
+			"docker.io":                 {Username: "hub-user"},
+			"registry.example.com:5000": {Username: "registry-user"},
+		}
+	})
+
+	It("finds Docker Hub credentials for unqualified references", func() {
+		creds, found := FindRegistryCredentials(credentials, "ubuntu:jammy")
+		Expect(found).To(BeTrue())
+		Expect(creds.Username).To(Equal("hub-user"))
+
+		creds, found = FindRegistryCredentials(credentials, "org/image:1.2")
+		Expect(found).To(BeTrue())
+		Expect(creds.Username).To(Equal("hub-user"))
+	})
+
+	It("finds Docker Hub credentials for digest-pinned unqualified references", func() {
+		creds, found := FindRegistryCredentials(credentials, "ubuntu@sha256:"+strings.Repeat("0", 64))
+		Expect(found).To(BeTrue())
+		Expect(creds.Username).To(Equal("hub-user"))
+	})
+
+	It("finds Docker Hub credentials keyed by its API host", func() {
+		credentials = map[string]config.RegistryCredentials{"registry-1.docker.io": {Username: "api-user"}}
+
+		creds, found := FindRegistryCredentials(credentials, "docker.io/library/ubuntu:jammy")
+		Expect(found).To(BeTrue())
+		Expect(creds.Username).To(Equal("api-user"))
+	})
+
+	It("finds credentials of registry with port", func() {
+		creds, found := FindRegistryCredentials(credentials, "registry.example.com:5000/org/image:1.2")
+		Expect(found).To(BeTrue())
+		Expect(creds.Username).To(Equal("registry-user"))
+	})
+
+	It("does not find credentials of other registries", func() {
+		_, found := FindRegistryCredentials(credentials, "ghcr.io/org/image:1.2")
+		Expect(found).To(BeFalse())
+	})
+})
+
+var _ = Describe("RegistryClient", func() {
+	var (
+		server    *httptest.Server
+		blobs     map[string][]byte
+		manifests map[string][]byte
+		requests  []string
+
+		layer          []byte
+		manifest       []byte
+		manifestDigest string
+
+		credentials map[string]config.RegistryCredentials
+		dstDir      string
+		host        string
+	)
+
+	digestOf := func(bytes []byte) string {
+		sum := sha256.Sum256(bytes)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	BeforeEach(func() {
+		requests = nil
+		blobs = map[string][]byte{}
+		manifests = map[string][]byte{}
+
+		imageConfig := []byte(`{"architecture":"amd64","os":"linux"}`)
+		layer = []byte("fake-layer-contents")
+
+		blobs[digestOf(imageConfig)] = imageConfig
+		blobs[digestOf(layer)] = layer
+
+		var err error
+		manifest, err = json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+			"config": map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.config.v1+json",
+				"digest":    digestOf(imageConfig),
+				"size":      len(imageConfig),
+			},
+			"layers": []map[string]interface{}{{
+				"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+				"digest":    digestOf(layer),
+				"size":      len(layer),
+			}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		manifestDigest = digestOf(manifest)
+		manifests["1.2"] = manifest
+		manifests[manifestDigest] = manifest
+
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+
+			if r.URL.Path == "/token" {
+				user, pass, _ := r.BasicAuth()
+				if user != "fake-user" || pass != "fake-password" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				Expect(r.URL.Query().Get("scope")).To(Equal("repository:org/image:pull"))
+				w.Write([]byte(`{"token":"fake-token"}`)) //nolint:errcheck
+				return
+			}
+
+			if r.Header.Get("Authorization") != "Bearer fake-token" {
+				w.Header().Set("WWW-Authenticate",
+					`Bearer realm="https://`+r.Host+`/token",service="fake-registry"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if ref, found := strings.CutPrefix(r.URL.Path, "/v2/org/image/manifests/"); found {
+				if contents, found := manifests[ref]; found {
+					mediaType := "application/vnd.oci.image.manifest.v1+json"
+					if strings.Contains(string(contents), `"manifests"`) {
+						mediaType = "application/vnd.oci.image.index.v1+json"
+					}
+					w.Header().Set("Content-Type", mediaType)
+					w.Write(contents) //nolint:errcheck
+					return
+				}
+			}
+
+			if digest, found := strings.CutPrefix(r.URL.Path, "/v2/org/image/blobs/"); found {
+				if contents, found := blobs[digest]; found {
+					w.Write(contents) //nolint:errcheck
+					return
+				}
+			}
+
+			w.WriteHeader(http.StatusNotFound)
+		}))
+
+		host = strings.TrimPrefix(server.URL, "https://")
+		credentials = map[string]config.RegistryCredentials{
+			host: {Username: "fake-user", Password: "fake-password"},
+		}
+		dstDir = filepath.Join(GinkgoT().TempDir(), "layout")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newClient := func() RegistryClient {
+		fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		return NewRegistryClient(server.Client(), credentials, fs, boshlog.NewLogger(boshlog.LevelNone))
+	}
+
+	pull := func(ref string) (string, error) {
+		imageRef, err := ParseImageReference(ref)
+		Expect(err).ToNot(HaveOccurred())
+
+		return newClient().Pull(imageRef, dstDir)
+	}
+
+	resolve := func(ref, arch string) (string, error) {
+		imageRef, err := ParseImageReference(ref)
+		Expect(err).ToNot(HaveOccurred())
+
+		return newClient().Resolve(imageRef, arch)
+	}
+
+	It("stores image in OCI image layout and returns manifest digest", func() {
+		digest, err := pull(host + "/org/image:1.2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digest).To(Equal(manifestDigest))
+
+		Expect(filepath.Join(dstDir, "oci-layout")).To(BeAnExistingFile())
+
+		contents, err := os.ReadFile(filepath.Join(dstDir, "blobs", "sha256", strings.TrimPrefix(digestOf(layer), "sha256:")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal(layer))
+
+		contents, err = os.ReadFile(filepath.Join(dstDir, "blobs", "sha256", strings.TrimPrefix(manifestDigest, "sha256:")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal(manifest))
+
+		index, err := os.ReadFile(filepath.Join(dstDir, "index.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(index)).To(ContainSubstring(manifestDigest))
+		Expect(string(index)).To(ContainSubstring(`"org.opencontainers.image.ref.name":"1.2"`))
+	})
+
+	It("pulls image by digest", func() {
+		digest, err := pull(host + "/org/image@" + manifestDigest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digest).To(Equal(manifestDigest))
+
+		Expect(requests).To(ContainElement("/v2/org/image/manifests/" + manifestDigest))
+	})
+
+	It("returns error if manifest does not match requested digest", func() {
+		otherDigest := "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+		manifests[otherDigest] = manifest
+
+		_, err := pull(host + "/org/image@" + otherDigest)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("has digest '" + manifestDigest + "'"))
+	})
+
+	It("returns error if blob does not match its digest", func() {
+		blobs[digestOf(layer)] = []byte("tampered-layer-contents")
+
+		_, err := pull(host + "/org/image:1.2")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Downloaded blob '" + digestOf(layer) + "' has digest"))
+
+		Expect(filepath.Join(dstDir, "oci-layout")).ToNot(BeAnExistingFile())
+
+		layerPath := filepath.Join(dstDir, "blobs", "sha256", strings.TrimPrefix(digestOf(layer), "sha256:"))
+		Expect(layerPath).ToNot(BeAnExistingFile())
+		Expect(layerPath + ".partial").ToNot(BeAnExistingFile())
+	})
+
+	It("returns error if registry rejects credentials", func() {
+		credentials[host] = config.RegistryCredentials{Username: "fake-user", Password: "wrong-password"}
+
+		_, err := pull(host + "/org/image:1.2")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("responded with status '401 Unauthorized'"))
+	})
+
+	Describe("Resolve", func() {
+		var indexDigest string
+
+		BeforeEach(func() {
+			index, err := json.Marshal(map[string]interface{}{
+				"schemaVersion": 2,
+				"mediaType":     "application/vnd.oci.image.index.v1+json",
+				"manifests": []map[string]interface{}{{
+					"mediaType": "application/vnd.oci.image.manifest.v1+json",
+					"digest":    "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+					"size":      100,
+					"platform":  map[string]string{"os": "linux", "architecture": "amd64"},
+				}, {
+					"mediaType": "application/vnd.oci.image.manifest.v1+json",
+					"digest":    manifestDigest,
+					"size":      len(manifest),
+					"platform":  map[string]string{"os": "linux", "architecture": "arm64", "variant": "v8"},
+				}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			indexDigest = digestOf(index)
+			manifests["multi"] = index
+			manifests[indexDigest] = index
+		})
+
+		It("returns digest of platform-specific manifest from index", func() {
+			digest, err := resolve(host+"/org/image:multi", "arm64")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(digest).To(Equal(manifestDigest))
+		})
+
+		It("verifies digest of index", func() {
+			digest, err := resolve(host+"/org/image@"+indexDigest, "arm64")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(digest).To(Equal(manifestDigest))
+		})
+
+		It("returns digest of single-platform manifest", func() {
+			digest, err := resolve(host+"/org/image:1.2", "arm64")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(digest).To(Equal(manifestDigest))
+		})
+
+		It("returns error if index has no manifest for architecture", func() {
+			_, err := resolve(host+"/org/image:multi", "s390x")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(
+				"has no manifest for platform 'linux/s390x'; available platforms: linux/amd64, linux/arm64"))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package stemcell
+
+import (
+	"strings"
+)
+
+const defaultRegistryHost = "docker.io"
+
+// RegistryMirrors maps image reference prefixes to prefixes that replace them,
+// e.g. docker.io/ to registry.local:5000/
+type RegistryMirrors map[string]string
+
+// Rewrite replaces longest matching prefix of fully qualified image reference;
+// references that do not match any prefix are returned unchanged
+func (m RegistryMirrors) Rewrite(imageReference string) string {
+	qualifiedRef := qualifyImageReference(imageReference)
+
+	var matchedPrefix string
+
+	for prefix := range m {
+		if strings.HasPrefix(qualifiedRef, prefix) && len(prefix) > len(matchedPrefix) {
+			matchedPrefix = prefix
+		}
+	}
+
+	if matchedPrefix == "" {
+		return imageReference
+	}
+
+	return m[matchedPrefix] + strings.TrimPrefix(qualifiedRef, matchedPrefix)
+}
+
+// qualifyImageReference adds registry host (and library/ namespace for
+// official images) to references that rely on docker defaults,
+// e.g. ubuntu:noble becomes docker.io/library/ubuntu:noble
+func qualifyImageReference(imageReference string) string {
+	i := strings.Index(imageReference, "/")
+	if i < 0 {
+		return defaultRegistryHost + "/library/" + imageReference
+	}
+
+	host := imageReference[:i]
+	if host == "localhost" || strings.ContainsAny(host, ".:") {
+		return imageReference
+	}
+
+	return defaultRegistryHost + "/" + imageReference
+}
@@ -0,0 +1,42 @@
+package stemcell_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+)
+
+var _ = Describe("RegistryMirrors", func() {
+	Describe("Rewrite", func() {
+		mirrors := RegistryMirrors{
+			"docker.io/":              "registry.local:5000/",
+			"docker.io/cloudfoundry/": "registry.local:5000/cf/",
+			"ghcr.io/org/":            "registry.local:5000/ghcr/",
+		}
+
+		It("rewrites matching prefix", func() {
+			Expect(mirrors.Rewrite("ghcr.io/org/image:1.2")).To(Equal("registry.local:5000/ghcr/image:1.2"))
+		})
+
+		It("prefers longest matching prefix", func() {
+			Expect(mirrors.Rewrite("docker.io/cloudfoundry/ubuntu-noble:1.0")).To(
+				Equal("registry.local:5000/cf/ubuntu-noble:1.0"))
+		})
+
+		It("matches references that rely on default registry", func() {
+			Expect(mirrors.Rewrite("bosh/warden-stemcell:1.0")).To(Equal("registry.local:5000/bosh/warden-stemcell:1.0"))
+			Expect(mirrors.Rewrite("ubuntu:noble")).To(Equal("registry.local:5000/library/ubuntu:noble"))
+		})
+
+		It("keeps digest", func() {
+			digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+			Expect(mirrors.Rewrite("ghcr.io/org/image@" + digest)).To(Equal("registry.local:5000/ghcr/image@" + digest))
+		})
+
+		It("returns references that do not match unchanged", func() {
+			Expect(mirrors.Rewrite("quay.io/org/image:1.2")).To(Equal("quay.io/org/image:1.2"))
+			Expect(mirrors.Rewrite("localhost/image:1.2")).To(Equal("localhost/image:1.2"))
+		})
+	})
+})
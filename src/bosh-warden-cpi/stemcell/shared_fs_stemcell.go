@@ -0,0 +1,135 @@
+package stemcell
+
+import (
+	"path/filepath"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+
+	"bosh-warden-cpi/util"
+)
+
+// Unpacked image is kept in <stemcells dir>/<checksum>/image
+const sharedStemcellImageName = "image"
+
+// SharedFSStemcell is single import of stemcell whose unpacked image
+// is shared by all imports of identical stemcells
+type SharedFSStemcell struct {
+	id           apiv1.StemcellCID
+	stemcellPath string
+
+	locker util.FileLocker
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewSharedFSStemcell(
+	id apiv1.StemcellCID,
+	stemcellPath string,
+	locker util.FileLocker,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) SharedFSStemcell {
+	return SharedFSStemcell{id: id, stemcellPath: stemcellPath, locker: locker, fs: fs, logger: logger}
+}
+
+func (s SharedFSStemcell) ID() apiv1.StemcellCID { return s.id }
+
+func (s SharedFSStemcell) URI() string {
+	return filepath.Join(s.stemcellPath, sharedStemcellImageName)
+}
+
+func (s SharedFSStemcell) Metadata() (*Metadata, error) {
+	return newMetadataStore(s.URI(), s.fs).Load()
+}
+
+// LockImage takes shared lock that Delete needs exclusively so that
+// containers are not created while image is being deleted
+func (s SharedFSStemcell) LockImage() (func(), error) {
+	unlock, err := s.locker.RLock(sharedStemcellLockPath(s.stemcellPath))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Locking stemcell '%s'", s.id)
+	}
+
+	return unlock, nil
+}
+
+// Delete removes unpacked stemcell once no other imports reference it.
+// Containers are created from image of any import sharing it, hence
+// checkUnused has to look for containers by image rather than by CID.
+func (s SharedFSStemcell) Delete(checkUnused func() error) error {
+	s.logger.Debug("SharedFSStemcell", "Deleting stemcell '%s'", s.id)
+
+	unlock, err := s.locker.Lock(sharedStemcellLockPath(s.stemcellPath))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Locking stemcell '%s'", s.id)
+	}
+	defer unlock()
+
+	refs := newStemcellRefs(s.stemcellPath, s.fs)
+
+	count, err := refs.Count()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Dereferencing stemcell '%s'", s.id)
+	}
+
+	if refs.Has(s.id) {
+		count--
+	}
+
+	// Image is only checked once last reference goes away
+	// so that this reference is kept if image is still used
+	if count == 0 {
+		err = checkUnused()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = refs.Remove(s.id)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Dereferencing stemcell '%s'", s.id)
+	}
+
+	if count > 0 {
+		s.logger.Debug("SharedFSStemcell", "Keeping stemcell '%s' with %d remaining references", s.id, count)
+		return nil
+	}
+
+	err = s.fs.RemoveAll(s.stemcellPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Deleting stemcell directory '%s'", s.stemcellPath)
+	}
+
+	return nil
+}
+
+// sharedStemcellLockPath guards importing and deleting stemcells
+// with the same checksum across concurrently running CPI processes
+func sharedStemcellLockPath(stemcellPath string) string {
+	return stemcellPath + ".lock"
+}
+
+// findSharedFSStemcell looks for stemcell directory referenced by import with given CID
+func findSharedFSStemcell(
+	dirPath string,
+	id apiv1.StemcellCID,
+	locker util.FileLocker,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) (Stemcell, bool, error) {
+	matches, err := fs.Glob(filepath.Join(dirPath, "*", "refs", id.AsString()))
+	if err != nil {
+		return nil, false, bosherr.WrapErrorf(err, "Finding references of stemcell '%s'", id)
+	}
+
+	if len(matches) == 0 {
+		return nil, false, nil
+	}
+
+	stemcellPath := filepath.Dir(filepath.Dir(matches[0]))
+
+	return NewSharedFSStemcell(id, stemcellPath, locker, fs, logger), true, nil
+}
@@ -0,0 +1,149 @@
+package stemcell_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "bosh-warden-cpi/stemcell"
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("SharedFSStemcell", func() {
+	var (
+		fs       *fakesys.FakeFileSystem
+		locker   *util.RecordingNoopLocker
+		logger   boshlog.Logger
+		stemcell SharedFSStemcell
+	)
+
+	noUse := func() error { return nil }
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		locker = util.NewRecordingNoopLocker()
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		stemcell = NewSharedFSStemcell(
+			apiv1.NewStemcellCID("fake-stemcell-id"), "/fake-stemcells-dir/fake-checksum", locker, fs, logger)
+
+		err := fs.MkdirAll("/fake-stemcells-dir/fake-checksum/image", os.ModeDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = fs.WriteFileString("/fake-stemcells-dir/fake-checksum/refs/fake-stemcell-id", "")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("uses unpacked image as URI", func() {
+		Expect(stemcell.URI()).To(Equal("/fake-stemcells-dir/fake-checksum/image"))
+	})
+
+	It("returns metadata recorded next to unpacked image", func() {
+		err := fs.WriteFileString("/fake-stemcells-dir/fake-checksum/image.metadata.yml", "name: fake-name\n")
+		Expect(err).ToNot(HaveOccurred())
+
+		metadata, err := stemcell.Metadata()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata.Name).To(Equal("fake-name"))
+	})
+
+	Describe("LockImage", func() {
+		It("takes shared lock on stemcell directory", func() {
+			unlock, err := stemcell.LockImage()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(locker.RLockedPaths()).To(Equal([]string{"/fake-stemcells-dir/fake-checksum.lock"}))
+			Expect(locker.IsHeld("/fake-stemcells-dir/fake-checksum.lock")).To(BeTrue())
+
+			unlock()
+			Expect(locker.IsHeld("/fake-stemcells-dir/fake-checksum.lock")).To(BeFalse())
+		})
+	})
+
+	Describe("Delete", func() {
+		It("deletes stemcell directory once last reference goes away", func() {
+			err := stemcell.Delete(noUse)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum")).To(BeFalse())
+			Expect(locker.LockedPaths()).To(Equal([]string{"/fake-stemcells-dir/fake-checksum.lock"}))
+			Expect(locker.IsHeld("/fake-stemcells-dir/fake-checksum.lock")).To(BeFalse())
+		})
+
+		It("keeps directory while other imports of the same stemcell reference it", func() {
+			err := fs.WriteFileString("/fake-stemcells-dir/fake-checksum/refs/other-stemcell-id", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = stemcell.Delete(noUse)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/image")).To(BeTrue())
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/refs/fake-stemcell-id")).To(BeFalse())
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/refs/other-stemcell-id")).To(BeTrue())
+		})
+
+		It("does not drop references of other imports when deleted again", func() {
+			err := fs.WriteFileString("/fake-stemcells-dir/fake-checksum/refs/other-stemcell-id", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = stemcell.Delete(noUse)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = stemcell.Delete(noUse)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/image")).To(BeTrue())
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/refs/other-stemcell-id")).To(BeTrue())
+		})
+
+		It("checks that image is unused while holding lock once last reference goes away", func() {
+			checked := false
+
+			err := stemcell.Delete(func() error {
+				checked = true
+				Expect(locker.IsHeld("/fake-stemcells-dir/fake-checksum.lock")).To(BeTrue())
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checked).To(BeTrue())
+		})
+
+		It("keeps image used by containers created from other import that was deleted before", func() {
+			other := NewSharedFSStemcell(
+				apiv1.NewStemcellCID("other-stemcell-id"), "/fake-stemcells-dir/fake-checksum", locker, fs, logger)
+
+			err := fs.WriteFileString("/fake-stemcells-dir/fake-checksum/refs/other-stemcell-id", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			// Containers were created from other import hence only its image identifies them
+			inUse := func() error { return errors.New("fake-image-in-use-err") }
+
+			err = other.Delete(inUse)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = stemcell.Delete(inUse)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-image-in-use-err"))
+
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/image")).To(BeTrue())
+			Expect(fs.FileExists("/fake-stemcells-dir/fake-checksum/refs/fake-stemcell-id")).To(BeTrue())
+		})
+
+		It("returns error if deleting stemcell directory fails", func() {
+			fs.RemoveAllStub = func(path string) error {
+				if path == "/fake-stemcells-dir/fake-checksum" {
+					return errors.New("fake-remove-all-err")
+				}
+				return nil
+			}
+
+			err := stemcell.Delete(noUse)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-remove-all-err"))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package stemcell
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// stemcellRefs records which imports share single unpacked stemcell directory;
+// every import has its own CID kept as empty file in <dir>/refs/<cid>
+// so that deleting the same CID twice never drops references of other imports
+type stemcellRefs struct {
+	path string
+	fs   boshsys.FileSystem
+}
+
+func newStemcellRefs(stemcellPath string, fs boshsys.FileSystem) stemcellRefs {
+	return stemcellRefs{path: filepath.Join(stemcellPath, "refs"), fs: fs}
+}
+
+func (r stemcellRefs) Add(cid apiv1.StemcellCID) error {
+	err := r.fs.MkdirAll(r.path, os.FileMode(0755))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating references directory '%s'", r.path)
+	}
+
+	err = r.fs.WriteFileString(r.refPath(cid), "")
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing reference '%s'", r.refPath(cid))
+	}
+
+	return nil
+}
+
+func (r stemcellRefs) Remove(cid apiv1.StemcellCID) error {
+	err := r.fs.RemoveAll(r.refPath(cid))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing reference '%s'", r.refPath(cid))
+	}
+
+	return nil
+}
+
+func (r stemcellRefs) Has(cid apiv1.StemcellCID) bool {
+	return r.fs.FileExists(r.refPath(cid))
+}
+
+func (r stemcellRefs) Count() (int, error) {
+	if !r.fs.FileExists(r.path) {
+		return 0, nil
+	}
+
+	count := 0
+
+	err := r.fs.Walk(r.path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Counting references in '%s'", r.path)
+	}
+
+	return count, nil
+}
+
+func (r stemcellRefs) refPath(cid apiv1.StemcellCID) string {
+	return filepath.Join(r.path, cid.AsString())
+}
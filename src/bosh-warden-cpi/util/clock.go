@@ -0,0 +1,42 @@
+package util
+
+import (
+	"time"
+)
+
+// Clock bounds waits with deadlines rather than with number of attempts
+type Clock interface {
+	Sleeper
+	Now() time.Time
+}
+
+type RealClock struct {
+	RealSleeper
+}
+
+func (c RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock only moves forward when sleeping or when advanced explicitly
+type FakeClock struct {
+	*RecordingNoopSleeper
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{RecordingNoopSleeper: NewRecordingNoopSleeper(), now: now}
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.RecordingNoopSleeper.Sleep(d)
+	c.now = c.now.Add(d)
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func (c *FakeClock) Now() time.Time {
+	return c.now
+}
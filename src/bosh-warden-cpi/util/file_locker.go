@@ -0,0 +1,86 @@
+package util
+
+import (
+	"os"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"golang.org/x/sys/unix"
+)
+
+// FileLocker serializes work of concurrently running CPI processes
+type FileLocker interface {
+	// Lock blocks until exclusive lock on path is acquired;
+	// returned func releases the lock
+	Lock(path string) (func(), error)
+
+	// RLock blocks until shared lock on path is acquired;
+	// any number of shared locks can be held while no exclusive lock is
+	RLock(path string) (func(), error)
+}
+
+// FlockLocker takes advisory flock(2) locks on lock files
+// which are created if necessary and are never removed
+type FlockLocker struct{}
+
+func (l FlockLocker) Lock(path string) (func(), error) {
+	return l.flock(path, unix.LOCK_EX)
+}
+
+func (l FlockLocker) RLock(path string) (func(), error) {
+	return l.flock(path, unix.LOCK_SH)
+}
+
+func (l FlockLocker) flock(path string, how int) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, os.FileMode(0644))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Opening lock file '%s'", path)
+	}
+
+	err = unix.Flock(int(file.Fd()), how)
+	if err != nil {
+		file.Close() //nolint:errcheck
+		return nil, bosherr.WrapErrorf(err, "Locking '%s'", path)
+	}
+
+	return func() {
+		// Closing file releases the lock
+		file.Close() //nolint:errcheck
+	}, nil
+}
+
+type RecordingNoopLocker struct {
+	lockedPaths  []string
+	rlockedPaths []string
+	heldPaths    map[string]bool
+}
+
+func NewRecordingNoopLocker() *RecordingNoopLocker {
+	return &RecordingNoopLocker{heldPaths: map[string]bool{}}
+}
+
+func (l *RecordingNoopLocker) Lock(path string) (func(), error) {
+	l.lockedPaths = append(l.lockedPaths, path)
+	l.heldPaths[path] = true
+
+	return func() { delete(l.heldPaths, path) }, nil
+}
+
+func (l *RecordingNoopLocker) RLock(path string) (func(), error) {
+	l.rlockedPaths = append(l.rlockedPaths, path)
+	l.heldPaths[path] = true
+
+	return func() { delete(l.heldPaths, path) }, nil
+}
+
+func (l *RecordingNoopLocker) RLockedPaths() []string {
+	return l.rlockedPaths
+}
+
+func (l *RecordingNoopLocker) LockedPaths() []string {
+	return l.lockedPaths
+}
+
+// IsHeld tells whether lock on path was acquired and not yet released
+func (l *RecordingNoopLocker) IsHeld(path string) bool {
+	return l.heldPaths[path]
+}
@@ -0,0 +1,73 @@
+package util_test
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("FlockLocker", func() {
+	It("blocks other lockers of the same path until lock is released", func() {
+		lockPath := filepath.Join(GinkgoT().TempDir(), "fake.lock")
+
+		unlock, err := util.FlockLocker{}.Lock(lockPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lockPath).To(BeAnExistingFile())
+
+		locked := make(chan struct{})
+
+		go func() {
+			defer GinkgoRecover()
+
+			unlockOther, err := util.FlockLocker{}.Lock(lockPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			close(locked)
+			unlockOther()
+		}()
+
+		Consistently(locked, 100*time.Millisecond).ShouldNot(BeClosed())
+
+		unlock()
+
+		Eventually(locked).Should(BeClosed())
+	})
+
+	It("lets shared lockers hold lock together but blocks exclusive lockers", func() {
+		lockPath := filepath.Join(GinkgoT().TempDir(), "fake.lock")
+
+		unlockShared, err := util.FlockLocker{}.RLock(lockPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		unlockOtherShared, err := util.FlockLocker{}.RLock(lockPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		locked := make(chan struct{})
+
+		go func() {
+			defer GinkgoRecover()
+
+			unlock, err := util.FlockLocker{}.Lock(lockPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			close(locked)
+			unlock()
+		}()
+
+		unlockShared()
+		Consistently(locked, 100*time.Millisecond).ShouldNot(BeClosed())
+
+		unlockOtherShared()
+		Eventually(locked).Should(BeClosed())
+	})
+
+	It("returns error if lock file cannot be created", func() {
+		_, err := util.FlockLocker{}.Lock(filepath.Join(GinkgoT().TempDir(), "missing", "fake.lock"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Opening lock file"))
+	})
+})
@@ -0,0 +1,399 @@
+package util
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/sys/unix"
+)
+
+type Decompressor interface {
+	Decompress(src, dest string) error
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// StreamingDecompressor decompresses gzip, zstd or xz compressed (or uncompressed)
+// images in a single pass without external binaries or temporary copies.
+// When expanding, images are tar archives unpacked into dest preserving
+// ownership like tar --same-owner; otherwise decompressed image is written to dest.
+type StreamingDecompressor struct {
+	expandTarball bool
+
+	// Progress is logged every time this fraction of source is read
+	progressStep float64
+
+	logTag string
+	logger boshlog.Logger
+}
+
+func NewStreamingDecompressor(expandTarball bool, logger boshlog.Logger) StreamingDecompressor {
+	return StreamingDecompressor{
+		expandTarball: expandTarball,
+		progressStep:  0.1,
+
+		logTag: "StreamingDecompressor",
+		logger: logger,
+	}
+}
+
+func (d StreamingDecompressor) Decompress(src, dest string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Opening '%s'", src)
+	}
+	defer srcFile.Close() //nolint:errcheck
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking '%s'", src)
+	}
+
+	progress := &progressReader{
+		reader: srcFile,
+		total:  srcInfo.Size(),
+		step:   d.progressStep,
+		logFunc: func(percent int, read int64) {
+			d.logger.Debug(d.logTag, "Decompressed %d%% (%d bytes) of '%s'", percent, read, src)
+		},
+	}
+
+	reader, compression, err := d.decompressingReader(bufio.NewReaderSize(progress, 1024*1024))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Decompressing '%s'", src)
+	}
+	defer reader.Close() //nolint:errcheck
+
+	d.logger.Debug(d.logTag, "Decompressing %s image '%s' to '%s'", compression, src, dest)
+
+	if d.expandTarball {
+		err = d.untar(reader, dest)
+	} else {
+		err = d.writeFile(reader, dest)
+	}
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Decompressing '%s' to '%s'", src, dest)
+	}
+
+	d.logger.Debug(d.logTag, "Decompressed '%s' to '%s'", src, dest)
+
+	return nil
+}
+
+func (d StreamingDecompressor) decompressingReader(reader *bufio.Reader) (io.ReadCloser, string, error) {
+	magic, err := reader.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, "", bosherr.WrapError(err, "Detecting compression")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, "", bosherr.WrapError(err, "Reading gzip header")
+		}
+		return gzipReader, "gzip", nil
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, "", bosherr.WrapError(err, "Reading zstd header")
+		}
+		return zstdReader.IOReadCloser(), "zstd", nil
+
+	case bytes.HasPrefix(magic, xzMagic):
+		xzReader, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, "", bosherr.WrapError(err, "Reading xz header")
+		}
+		return io.NopCloser(xzReader), "xz", nil
+
+	default:
+		return io.NopCloser(reader), "uncompressed", nil
+	}
+}
+
+func (d StreamingDecompressor) writeFile(reader io.Reader, dest string) error {
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0644))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dest)
+	}
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		file.Close() //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Writing '%s'", dest)
+	}
+
+	return file.Close()
+}
+
+type dirTimes struct {
+	path    string
+	modTime time.Time
+}
+
+func (d StreamingDecompressor) untar(reader io.Reader, dest string) error {
+	err := os.MkdirAll(dest, os.FileMode(0755))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dest)
+	}
+
+	// Directory times are restored last since creating entries changes them
+	var dirs []dirTimes
+
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bosherr.WrapError(err, "Reading tar entry")
+		}
+
+		path, err := d.entryPath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+
+		err = d.extractEntry(tarReader, header, dest, path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Extracting '%s'", header.Name)
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTimes{path: path, modTime: header.ModTime})
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Setting times of '%s'", dirs[i].path)
+		}
+	}
+
+	return nil
+}
+
+func (d StreamingDecompressor) extractEntry(reader io.Reader, header *tar.Header, dest, path string) error {
+	mode := uint32(header.Mode & 07777)
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		err := os.MkdirAll(path, os.FileMode(0755))
+		if err != nil {
+			return err
+		}
+
+	case tar.TypeReg:
+		err := d.removeExisting(path)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(0600))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, reader)
+		if err != nil {
+			file.Close() //nolint:errcheck
+			return err
+		}
+
+		err = file.Close()
+		if err != nil {
+			return err
+		}
+
+	case tar.TypeSymlink:
+		err := d.removeExisting(path)
+		if err != nil {
+			return err
+		}
+
+		err = os.Symlink(header.Linkname, path)
+		if err != nil {
+			return err
+		}
+
+		// Symlinks have no mode or times of their own to restore
+		return os.Lchown(path, header.Uid, header.Gid)
+
+	case tar.TypeLink:
+		targetPath, err := d.entryPath(dest, header.Linkname)
+		if err != nil {
+			return err
+		}
+
+		err = d.removeExisting(path)
+		if err != nil {
+			return err
+		}
+
+		// Hard links share ownership, mode and times with their target
+		return os.Link(targetPath, path)
+
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		err := d.removeExisting(path)
+		if err != nil {
+			return err
+		}
+
+		fileType := map[byte]uint32{
+			tar.TypeChar:  unix.S_IFCHR,
+			tar.TypeBlock: unix.S_IFBLK,
+			tar.TypeFifo:  unix.S_IFIFO,
+		}[header.Typeflag]
+
+		dev := unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))
+
+		err = unix.Mknod(path, fileType|mode, int(dev))
+		if err != nil {
+			return err
+		}
+
+	default:
+		d.logger.Debug(d.logTag, "Skipping tar entry '%s' of type '%c'", header.Name, header.Typeflag)
+		return nil
+	}
+
+	// Ownership is changed before mode since chown clears setuid and setgid bits
+	err := os.Lchown(path, header.Uid, header.Gid)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(path, os.FileMode(mode&0777)|tarModeBits(mode))
+	if err != nil {
+		return err
+	}
+
+	if header.Typeflag != tar.TypeDir {
+		return os.Chtimes(path, header.ModTime, header.ModTime)
+	}
+
+	return nil
+}
+
+// entryPath returns path at which entry is extracted making sure that neither
+// entry name nor symlinks extracted earlier lead outside of dest
+func (d StreamingDecompressor) entryPath(dest, name string) (string, error) {
+	cleanName := filepath.Clean("/" + name)
+	path := filepath.Join(dest, cleanName)
+
+	if cleanName == "/" {
+		return dest, nil
+	}
+
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Resolving '%s'", dest)
+	}
+
+	// Closest existing ancestor must resolve to location within dest
+	ancestor := filepath.Dir(path)
+	for ancestor != dest {
+		if _, err := os.Lstat(ancestor); err == nil {
+			break
+		}
+		ancestor = filepath.Dir(ancestor)
+	}
+
+	realAncestor, err := filepath.EvalSymlinks(ancestor)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Resolving '%s'", ancestor)
+	}
+
+	if realAncestor != realDest && !strings.HasPrefix(realAncestor, realDest+string(filepath.Separator)) {
+		return "", bosherr.Errorf("Tar entry '%s' resolves outside of '%s'", name, dest)
+	}
+
+	return path, nil
+}
+
+func (d StreamingDecompressor) removeExisting(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return bosherr.Errorf("Cannot replace directory '%s'", path)
+	}
+
+	return os.Remove(path)
+}
+
+func tarModeBits(mode uint32) os.FileMode {
+	var fileMode os.FileMode
+
+	if mode&unix.S_ISUID != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if mode&unix.S_ISGID != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		fileMode |= os.ModeSticky
+	}
+
+	return fileMode
+}
+
+// progressReader calls logFunc every time another step fraction of total is read
+type progressReader struct {
+	reader io.Reader
+	total  int64
+	step   float64
+
+	read       int64
+	nextReport float64
+
+	logFunc func(percent int, read int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	if r.total > 0 {
+		fraction := float64(r.read) / float64(r.total)
+
+		if r.nextReport == 0 {
+			r.nextReport = r.step
+		}
+
+		if fraction >= r.nextReport {
+			r.logFunc(int(fraction*100), r.read)
+
+			for r.nextReport <= fraction {
+				r.nextReport += r.step
+			}
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,233 @@
+package util_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/klauspost/compress/zstd"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/ulikunitz/xz"
+
+	"bosh-warden-cpi/util"
+)
+
+var _ = Describe("StreamingDecompressor", func() {
+	var (
+		tmpDir  string
+		srcPath string
+		dstPath string
+		modTime time.Time
+	)
+
+	type tarEntry struct {
+		header   tar.Header
+		contents string
+	}
+
+	tarball := func(entries ...tarEntry) []byte {
+		var buf bytes.Buffer
+		tarWriter := tar.NewWriter(&buf)
+
+		for _, entry := range entries {
+			header := entry.header
+			header.Uid = os.Getuid()
+			header.Gid = os.Getgid()
+			header.ModTime = modTime
+			header.Size = int64(len(entry.contents))
+
+			err := tarWriter.WriteHeader(&header)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = tarWriter.Write([]byte(entry.contents))
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		Expect(tarWriter.Close()).To(Succeed())
+
+		return buf.Bytes()
+	}
+
+	compress := func(newWriter func(io.Writer) io.WriteCloser, contents []byte) []byte {
+		var buf bytes.Buffer
+		writer := newWriter(&buf)
+
+		_, err := writer.Write(contents)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+
+		return buf.Bytes()
+	}
+
+	gzipWriter := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+	zstdWriter := func(w io.Writer) io.WriteCloser {
+		writer, err := zstd.NewWriter(w)
+		Expect(err).ToNot(HaveOccurred())
+		return writer
+	}
+
+	xzWriter := func(w io.Writer) io.WriteCloser {
+		writer, err := xz.NewWriter(w)
+		Expect(err).ToNot(HaveOccurred())
+		return writer
+	}
+
+	writeSrc := func(contents []byte) {
+		err := os.WriteFile(srcPath, contents, os.FileMode(0644))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+		srcPath = filepath.Join(tmpDir, "image")
+		dstPath = filepath.Join(tmpDir, "dst")
+		modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	})
+
+	Context("when expanding tarball", func() {
+		var decompressor util.StreamingDecompressor
+
+		BeforeEach(func() {
+			decompressor = util.NewStreamingDecompressor(true, boshlog.NewLogger(boshlog.LevelNone))
+		})
+
+		rootfs := func() []byte {
+			return tarball(
+				tarEntry{header: tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0750}},
+				tarEntry{header: tar.Header{Name: "./etc/hostname", Typeflag: tar.TypeReg, Mode: 0640}, contents: "fake-hostname"},
+				tarEntry{header: tar.Header{Name: "./etc/link", Typeflag: tar.TypeSymlink, Linkname: "hostname"}},
+				tarEntry{header: tar.Header{Name: "./etc/hardlink", Typeflag: tar.TypeLink, Linkname: "./etc/hostname"}},
+			)
+		}
+
+		expectRootfs := func() {
+			contents, err := os.ReadFile(filepath.Join(dstPath, "etc", "hostname"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("fake-hostname"))
+
+			info, err := os.Stat(filepath.Join(dstPath, "etc", "hostname"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.FileMode(0640)))
+			Expect(info.ModTime().Equal(modTime)).To(BeTrue())
+
+			info, err = os.Stat(filepath.Join(dstPath, "etc"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+			Expect(info.ModTime().Equal(modTime)).To(BeTrue())
+
+			target, err := os.Readlink(filepath.Join(dstPath, "etc", "link"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("hostname"))
+
+			contents, err = os.ReadFile(filepath.Join(dstPath, "etc", "hardlink"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("fake-hostname"))
+		}
+
+		It("unpacks gzip compressed tarball", func() {
+			writeSrc(compress(gzipWriter, rootfs()))
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			expectRootfs()
+		})
+
+		It("unpacks zstd compressed tarball", func() {
+			writeSrc(compress(zstdWriter, rootfs()))
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			expectRootfs()
+		})
+
+		It("unpacks xz compressed tarball", func() {
+			writeSrc(compress(xzWriter, rootfs()))
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			expectRootfs()
+		})
+
+		It("unpacks uncompressed tarball", func() {
+			writeSrc(rootfs())
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			expectRootfs()
+		})
+
+		It("returns error if entry leads outside of destination", func() {
+			writeSrc(compress(gzipWriter, tarball(
+				tarEntry{header: tar.Header{Name: "./escape", Typeflag: tar.TypeSymlink, Linkname: tmpDir}},
+				tarEntry{header: tar.Header{Name: "./escape/evil", Typeflag: tar.TypeReg, Mode: 0644}, contents: "evil"},
+			)))
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Tar entry './escape/evil' resolves outside of"))
+
+			Expect(filepath.Join(tmpDir, "evil")).ToNot(BeAnExistingFile())
+		})
+
+		It("keeps parent directory references within destination", func() {
+			writeSrc(compress(gzipWriter, tarball(
+				tarEntry{header: tar.Header{Name: "../../evil", Typeflag: tar.TypeReg, Mode: 0644}, contents: "evil"},
+			)))
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(dstPath, "evil")).To(BeAnExistingFile())
+			Expect(filepath.Join(tmpDir, "evil")).ToNot(BeAnExistingFile())
+		})
+
+		It("returns error if compressed image is corrupted", func() {
+			contents := compress(gzipWriter, rootfs())
+			writeSrc(contents[:len(contents)/2])
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Decompressing '" + srcPath + "'"))
+		})
+
+		It("returns error if image does not exist", func() {
+			err := decompressor.Decompress(filepath.Join(tmpDir, "missing"), dstPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Opening"))
+		})
+	})
+
+	Context("when not expanding tarball", func() {
+		var decompressor util.StreamingDecompressor
+
+		BeforeEach(func() {
+			decompressor = util.NewStreamingDecompressor(false, boshlog.NewLogger(boshlog.LevelNone))
+		})
+
+		It("writes decompressed image to destination", func() {
+			writeSrc(compress(zstdWriter, []byte("fake-image-contents")))
+
+			err := decompressor.Decompress(srcPath, dstPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := os.ReadFile(dstPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("fake-image-contents"))
+
+			matches, err := filepath.Glob(filepath.Join(tmpDir, "*.gz"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(matches).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package vm
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wrdn "code.cloudfoundry.org/garden"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	agentReadinessCheckInterval = 1 * time.Second
+
+	// runsv restarts crashing agent every second so agent is only considered
+	// started once it stays up longer than that
+	agentStableUptime = 3 * time.Second
+
+	// Only end of process output is kept since it usually explains failures
+	maxCapturedOutputSize = 4096
+)
+
+// Matches status of runit service, e.g. "run: agent: (pid 123) 45s; run: log: (pid 120) 45s"
+var runitServiceUptimeRegexp = regexp.MustCompile(`^run: [^:]+: \(pid \d+\) (\d+)s`)
+
+// waitForAgent polls container until BOSH Agent keeps running; fails as soon as
+// bootstrap script of runit container fails or systemd gives up on agent unit
+func (c WardenCreator) waitForAgent(
+	container wrdn.Container, bootstrap wrdn.Process, stderr *capturedOutput, initSystem InitSystem) error {
+
+	timeout := time.Duration(c.Config.Actions.AgentReadinessTimeout) * time.Second
+	deadline := c.clock.Now().Add(timeout)
+
+	exited := make(chan int, 1)
+
+	go func() {
+		status, err := bootstrap.Wait()
+		if err != nil {
+			c.logger.Error("WardenCreator", "Failed waiting for bootstrap script: %s", err)
+			status = -1
+		}
+		exited <- status
+	}()
+
+	for {
+		select {
+		case status := <-exited:
+			exited = nil
+
+			// Custom scripts may start runsvdir in background and exit successfully;
+			// systemd starts agent regardless of how preparing container went
+			if status != 0 && initSystem == InitSystemRunit {
+				return bosherr.Errorf("Bootstrap script exited with status %d before BOSH Agent started; "+
+					"stderr: %s; agent log: %s", status, stderr, c.agentLog(container))
+			}
+
+			if status != 0 {
+				c.logger.Warn("WardenCreator", "Bootstrap script of container '%s' exited with status %d; stderr: %s",
+					container.Handle(), status, stderr)
+			}
+		default:
+		}
+
+		ready, err := c.checkAgent(container, initSystem)
+		if err != nil {
+			return err
+		}
+
+		if ready {
+			c.logger.Debug("WardenCreator", "BOSH Agent is running in container '%s'", container.Handle())
+			return nil
+		}
+
+		if !c.clock.Now().Before(deadline) {
+			if initSystem == InitSystemSystemD {
+				return bosherr.Errorf("BOSH Agent unit did not become active within %s", timeout)
+			}
+
+			return bosherr.Errorf("BOSH Agent did not start within %s; bootstrap script stderr: %s; agent log: %s",
+				timeout, stderr, c.agentLog(container))
+		}
+
+		c.clock.Sleep(agentReadinessCheckInterval)
+	}
+}
+
+func (c WardenCreator) checkAgent(container wrdn.Container, initSystem InitSystem) (bool, error) {
+	if initSystem == InitSystemSystemD {
+		state, _, err := c.runInContainer(container, "systemctl is-active bosh-agent")
+		if err != nil {
+			return false, bosherr.WrapError(err, "Checking state of BOSH Agent unit")
+		}
+
+		switch strings.TrimSpace(state) {
+		case "active":
+			return true, nil
+		case "failed":
+			logs, _, err := c.runInContainer(container, "journalctl --unit bosh-agent --lines 50 --no-pager")
+			if err != nil {
+				logs = err.Error()
+			}
+			return false, bosherr.Errorf("BOSH Agent unit failed; journal: %s", logs)
+		default:
+			return false, nil
+		}
+	}
+
+	// Fails until runsvdir supervises agent service
+	output, _, err := c.runInContainer(container, "sv status agent")
+	if err != nil {
+		return false, bosherr.WrapError(err, "Checking status of BOSH Agent service")
+	}
+
+	matches := runitServiceUptimeRegexp.FindStringSubmatch(output)
+	if matches == nil {
+		return false, nil
+	}
+
+	uptime, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return false, nil
+	}
+
+	return time.Duration(uptime)*time.Second >= agentStableUptime, nil
+}
+
+// agentLog returns end of log that runit keeps for agent service
+func (c WardenCreator) agentLog(container wrdn.Container) string {
+	logs, _, err := c.runInContainer(container, "tail -n 50 /var/vcap/bosh/log/current")
+	if err != nil {
+		return err.Error()
+	}
+
+	return logs
+}
+
+// runInContainer returns stdout and exit status of script
+func (c WardenCreator) runInContainer(container wrdn.Container, script string) (string, int, error) {
+	stdout := &capturedOutput{}
+
+	processSpec := wrdn.ProcessSpec{
+		Path: "/bin/bash",
+		User: "root",
+		Args: []string{"-c", script},
+	}
+
+	process, err := container.Run(processSpec, wrdn.ProcessIO{Stdout: stdout})
+	if err != nil {
+		return "", 0, bosherr.WrapErrorf(err, "Running '%s'", script)
+	}
+
+	status, err := process.Wait()
+	if err != nil {
+		return "", 0, bosherr.WrapErrorf(err, "Waiting for '%s'", script)
+	}
+
+	return stdout.String(), status, nil
+}
+
+// capturedOutput keeps end of output written by container process
+// which is written to concurrently with reads while process runs
+type capturedOutput struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (o *capturedOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf = append(o.buf, p...)
+	if len(o.buf) > maxCapturedOutputSize {
+		o.buf = o.buf[len(o.buf)-maxCapturedOutputSize:]
+	}
+
+	return len(p), nil
+}
+
+func (o *capturedOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return string(bytes.TrimSpace(o.buf))
+}
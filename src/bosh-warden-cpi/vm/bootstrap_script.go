@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// defaultBootstrapScripts are used for stemcells without configured bootstrap script
+var defaultBootstrapScripts = map[InitSystem]string{
+	InitSystemRunit: strings.Join([]string{
+		"umount /etc/resolv.conf",
+		"umount /etc/hosts",
+		"umount /etc/hostname",
+		"rm -rf /var/vcap/data/sys",
+		"mkdir -p /var/vcap/data/sys",
+		"sed -i 's/chronyc/# chronyc/g' /var/vcap/bosh/bin/sync-time",
+		"exec env -i /usr/sbin/runsvdir-start",
+	}, "\n"),
+
+	// Agent is started by systemd itself
+	InitSystemSystemD: "umount /etc/hosts",
+}
+
+// BootstrapScriptParams are available to bootstrap script templates, e.g. {{.AgentID}}
+type BootstrapScriptParams struct {
+	VMCID       string
+	AgentID     string
+	StemcellCID string
+
+	// Empty for stemcells without metadata
+	OperatingSystem string
+	StemcellVersion string
+
+	InitSystem InitSystem
+}
+
+// renderBootstrapScript picks script configured for stemcell operating system and
+// init system of container (e.g. ubuntu-jammy/runit) falling back to default script
+// of init system so that overriding init system never runs script meant for another one
+func renderBootstrapScript(scripts map[string]string, params BootstrapScriptParams) (string, error) {
+	key := params.OperatingSystem + "/" + string(params.InitSystem)
+
+	script, found := scripts[key]
+	if !found || params.OperatingSystem == "" {
+		return defaultBootstrapScripts[params.InitSystem], nil
+	}
+
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(script)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Parsing bootstrap script for '%s'", key)
+	}
+
+	var buf bytes.Buffer
+
+	err = tmpl.Execute(&buf, params)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Rendering bootstrap script for '%s'", key)
+	}
+
+	return buf.String(), nil
+}
+
+// processLogWriter logs every line written by container process
+type processLogWriter struct {
+	logLine func(string)
+	partial []byte
+}
+
+func (w *processLogWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.logLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
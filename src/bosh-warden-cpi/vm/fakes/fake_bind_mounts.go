@@ -4,6 +4,8 @@ import (
 	"path/filepath"
 
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+
+	bwcdisk "bosh-warden-cpi/disk"
 )
 
 type FakeGuestBindMounts struct {
@@ -23,6 +25,10 @@ func (gbm FakeGuestBindMounts) MountPersistent(diskID apiv1.DiskCID) string {
 	return filepath.Join(gbm.PersistentBindMountsDir, diskID.AsString())
 }
 
+func (gbm FakeGuestBindMounts) PersistentDiskHint(diskID apiv1.DiskCID) apiv1.DiskHint {
+	return apiv1.NewDiskHintFromString(gbm.MountPersistent(diskID))
+}
+
 type FakeHostBindMounts struct {
 	MakeEphemeralID   apiv1.VMCID
 	MakeEphemeralPath string
@@ -41,11 +47,13 @@ type FakeHostBindMounts struct {
 	DeletePersistentErr    error
 
 	MountPersistentID       apiv1.VMCID
+	MountPersistentDisk     bwcdisk.Disk
 	MountPersistentDiskID   apiv1.DiskCID
 	MountPersistentDiskPath string
 	MountPersistentErr      error
 
 	UnmountPersistentID     apiv1.VMCID
+	UnmountPersistentDisk   bwcdisk.Disk
 	UnmountPersistentDiskID apiv1.DiskCID
 	UnmountPersistentErr    error
 }
@@ -72,15 +80,17 @@ func (hbm *FakeHostBindMounts) DeletePersistent(id apiv1.VMCID) error {
 	return hbm.DeletePersistentErr
 }
 
-func (hbm *FakeHostBindMounts) MountPersistent(id apiv1.VMCID, diskID apiv1.DiskCID, diskPath string) error {
+func (hbm *FakeHostBindMounts) MountPersistent(id apiv1.VMCID, disk bwcdisk.Disk) error {
 	hbm.MountPersistentID = id
-	hbm.MountPersistentDiskID = diskID
-	hbm.MountPersistentDiskPath = diskPath
+	hbm.MountPersistentDisk = disk
+	hbm.MountPersistentDiskID = disk.ID()
+	hbm.MountPersistentDiskPath = disk.Path()
 	return hbm.MountPersistentErr
 }
 
-func (hbm *FakeHostBindMounts) UnmountPersistent(id apiv1.VMCID, diskID apiv1.DiskCID) error {
+func (hbm *FakeHostBindMounts) UnmountPersistent(id apiv1.VMCID, disk bwcdisk.Disk) error {
 	hbm.UnmountPersistentID = id
-	hbm.UnmountPersistentDiskID = diskID
+	hbm.UnmountPersistentDisk = disk
+	hbm.UnmountPersistentDiskID = disk.ID()
 	return hbm.UnmountPersistentErr
 }
@@ -1,6 +1,9 @@
 package fakes
 
 import (
+	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
+
+	bwcstem "bosh-warden-cpi/stemcell"
 	bwcvm "bosh-warden-cpi/vm"
 )
 
@@ -9,9 +12,18 @@ type FakeFinder struct {
 	FindVM    bwcvm.VM
 	FindFound bool
 	FindErr   error
+
+	FindByStemcellStemcell bwcstem.Stemcell
+	FindByStemcellIDs      []apiv1.VMCID
+	FindByStemcellErr      error
 }
 
 func (f *FakeFinder) Find(id string) (bwcvm.VM, bool, error) {
 	f.FindID = id
 	return f.FindVM, f.FindFound, f.FindErr
 }
+
+func (f *FakeFinder) FindByStemcell(stemcell bwcstem.Stemcell) ([]apiv1.VMCID, error) {
+	f.FindByStemcellStemcell = stemcell
+	return f.FindByStemcellIDs, f.FindByStemcellErr
+}
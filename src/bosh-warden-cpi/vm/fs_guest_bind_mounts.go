@@ -15,17 +15,22 @@ type FSGuestBindMounts struct {
 	// Directory with sub-directories at which 0+ persistent disks are mounted
 	persistentBindMountsDir string
 
+	// Persistent disks show up as block devices instead of mounted directories
+	attachAsBlockDevices bool
+
 	logger boshlog.Logger
 }
 
 func NewFSGuestBindMounts(
 	ephemeralBindMountPath string,
 	persistentBindMountsDir string,
+	attachAsBlockDevices bool,
 	logger boshlog.Logger,
 ) FSGuestBindMounts {
 	return FSGuestBindMounts{
 		ephemeralBindMountPath:  ephemeralBindMountPath,
 		persistentBindMountsDir: persistentBindMountsDir,
+		attachAsBlockDevices:    attachAsBlockDevices,
 
 		logger: logger,
 	}
@@ -42,3 +47,15 @@ func (gbm FSGuestBindMounts) MakePersistent() string {
 func (gbm FSGuestBindMounts) MountPersistent(id apiv1.DiskCID) string {
 	return filepath.Join(gbm.persistentBindMountsDir, id.AsString())
 }
+
+func (gbm FSGuestBindMounts) PersistentDiskHint(id apiv1.DiskCID) apiv1.DiskHint {
+	path := gbm.MountPersistent(id)
+
+	if gbm.attachAsBlockDevices {
+		// Agent resolves device path hints to a block device that it partitions,
+		// formats and mounts itself, like it does on other infrastructures
+		return apiv1.NewDiskHintFromMap(map[string]interface{}{"path": path})
+	}
+
+	return apiv1.NewDiskHintFromString(path)
+}
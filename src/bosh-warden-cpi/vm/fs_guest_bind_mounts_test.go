@@ -19,6 +19,7 @@ var _ = Describe("FSGuestBindMounts", func() {
 		guestBindMounts = NewFSGuestBindMounts(
 			"/fake-ephemeral-path",
 			"/fake-persistent-dir",
+			false,
 			logger,
 		)
 	})
@@ -43,4 +44,28 @@ var _ = Describe("FSGuestBindMounts", func() {
 			Expect(path).To(Equal("/fake-persistent-dir/fake-disk-id"))
 		})
 	})
+	Describe("PersistentDiskHint", func() {
+		It("returns mounted directory path as a string hint", func() {
+			hint := guestBindMounts.PersistentDiskHint(apiv1.NewDiskCID("fake-disk-id"))
+			Expect(hint).To(Equal(apiv1.NewDiskHintFromString("/fake-persistent-dir/fake-disk-id")))
+		})
+
+		Context("when disks are attached as block devices", func() {
+			BeforeEach(func() {
+				logger := boshlog.NewLogger(boshlog.LevelNone)
+				guestBindMounts = NewFSGuestBindMounts(
+					"/fake-ephemeral-path",
+					"/fake-persistent-dir",
+					true,
+					logger,
+				)
+			})
+
+			It("returns device path hint so that agent formats and mounts disk itself", func() {
+				hint := guestBindMounts.PersistentDiskHint(apiv1.NewDiskCID("fake-disk-id"))
+				Expect(hint).To(Equal(apiv1.NewDiskHintFromMap(
+					map[string]interface{}{"path": "/fake-persistent-dir/fake-disk-id"})))
+			})
+		})
+	})
 })
@@ -11,6 +11,7 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	boshsys "github.com/cloudfoundry/bosh-utils/system"
 
+	bwcdisk "bosh-warden-cpi/disk"
 	bwcutil "bosh-warden-cpi/util"
 )
 
@@ -22,6 +23,12 @@ type FSHostBindMounts struct {
 	// Directory with sub-directories at which ephemeral disks are mounted
 	persistentBindMountsDir string
 
+	// Persistent disks are exposed as loop devices instead of mounted directories
+	attachAsBlockDevices bool
+
+	// Opens encrypted disks while they are attached
+	luks bwcdisk.LUKS
+
 	sleeper   bwcutil.Sleeper
 	fs        boshsys.FileSystem
 	cmdRunner boshsys.CmdRunner
@@ -31,6 +38,8 @@ type FSHostBindMounts struct {
 func NewFSHostBindMounts(
 	ephemeralBindMountsDir string,
 	persistentBindMountsDir string,
+	attachAsBlockDevices bool,
+	encryptionKeyFilePath string,
 	sleeper bwcutil.Sleeper,
 	fs boshsys.FileSystem,
 	cmdRunner boshsys.CmdRunner,
@@ -39,6 +48,8 @@ func NewFSHostBindMounts(
 	return FSHostBindMounts{
 		ephemeralBindMountsDir:  ephemeralBindMountsDir,
 		persistentBindMountsDir: persistentBindMountsDir,
+		attachAsBlockDevices:    attachAsBlockDevices,
+		luks:                    bwcdisk.NewLUKS(encryptionKeyFilePath, cmdRunner),
 
 		sleeper:   sleeper,
 		fs:        fs,
@@ -142,7 +153,8 @@ func (hbm FSHostBindMounts) DeletePersistent(id apiv1.VMCID) error {
 		}
 
 		for _, mountedDiskPath := range mountedDiskPaths {
-			err := hbm.unmountPath(mountedDiskPath)
+			// Disk metadata is not known here hence mappings are looked up on the host
+			err := hbm.unmountDiskPath(mountedDiskPath, hbm.hasMapping(mountedDiskPath))
 			if err != nil {
 				return bosherr.WrapErrorf(err, "Unmounting persistent disk '%s'", mountedDiskPath)
 			}
@@ -162,15 +174,63 @@ func (hbm FSHostBindMounts) DeletePersistent(id apiv1.VMCID) error {
 	return nil
 }
 
-func (hbm FSHostBindMounts) MountPersistent(id apiv1.VMCID, diskID apiv1.DiskCID, diskPath string) error {
-	path := filepath.Join(hbm.persistentBindMountsDir, id.AsString(), diskID.AsString())
+func (hbm FSHostBindMounts) MountPersistent(id apiv1.VMCID, disk bwcdisk.Disk) error {
+	path := filepath.Join(hbm.persistentBindMountsDir, id.AsString(), disk.ID().AsString())
+
+	readOnly := disk.Props().ReadOnly
+
+	// Read-only disks may be shared; mounting the same filesystem
+	// read-write from several VMs would corrupt it
+	if !readOnly {
+		err := hbm.checkNotAttachedElsewhere(id, disk.ID())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Directory and tmpfs disks are directories on the host
+	switch disk.Props().Type {
+	case bwcdisk.DiskTypeDirectory, bwcdisk.DiskTypeTmpfs:
+		if hbm.attachAsBlockDevices {
+			return bosherr.Errorf("%s disk '%s' cannot be attached as a block device",
+				disk.Props().Type, disk.ID().AsString())
+		}
+
+		return hbm.mountDirectory(path, disk.Path(), readOnly)
+	}
+
+	if disk.Props().Encrypted {
+		return hbm.mountEncrypted(path, disk.Path(), readOnly)
+	}
+
+	isBlockDevice := disk.Props().Type == bwcdisk.DiskTypeLVM
+
+	if hbm.attachAsBlockDevices {
+		// Read-only volumes are exposed through read-only loop devices
+		// since writes through bind mounted device nodes ignore ro mounts
+		if isBlockDevice && !readOnly {
+			return hbm.bindDevice(path, disk.Path())
+		}
+
+		return hbm.mountDevice(path, disk.Path(), readOnly)
+	}
+
+	// Logical volumes are mounted directly without loop devices
+	if isBlockDevice {
+		return hbm.mountBlockDevice(path, disk.Path(), readOnly)
+	}
 
 	err := hbm.fs.MkdirAll(path, os.FileMode(0755))
 	if err != nil {
 		return bosherr.WrapError(err, "Making disk specific persistent bind mount")
 	}
 
-	_, _, _, err = hbm.cmdRunner.RunCommand("mount", diskPath, path, "-o", "loop")
+	mountOpts := "loop"
+	if readOnly {
+		mountOpts = "loop,ro"
+	}
+
+	_, _, _, err = hbm.cmdRunner.RunCommand("mount", disk.Path(), path, "-o", mountOpts)
 	if err != nil {
 		return bosherr.WrapError(err, "Mounting disk specific persistent bind mount")
 	}
@@ -178,9 +238,234 @@ func (hbm FSHostBindMounts) MountPersistent(id apiv1.VMCID, diskID apiv1.DiskCID
 	return nil
 }
 
-func (hbm FSHostBindMounts) UnmountPersistent(id apiv1.VMCID, diskID apiv1.DiskCID) error {
-	path := filepath.Join(hbm.persistentBindMountsDir, id.AsString(), diskID.AsString())
-	return hbm.unmountPath(path)
+func (hbm FSHostBindMounts) UnmountPersistent(id apiv1.VMCID, disk bwcdisk.Disk) error {
+	path := filepath.Join(hbm.persistentBindMountsDir, id.AsString(), disk.ID().AsString())
+	return hbm.unmountDiskPath(path, disk.Props().Encrypted)
+}
+
+// mountEncrypted opens LUKS container of disk image and
+// mounts or exposes its mapped device instead of the image
+func (hbm FSHostBindMounts) mountEncrypted(path, diskPath string, readOnly bool) error {
+	mappingName := hbm.mappingName(path)
+
+	device, err := hbm.luks.Open(diskPath, mappingName, readOnly)
+	if err != nil {
+		return err
+	}
+
+	if hbm.attachAsBlockDevices {
+		err = hbm.bindDevice(path, device)
+	} else {
+		err = hbm.mountBlockDevice(path, device, readOnly)
+	}
+	if err != nil {
+		closeErr := hbm.luks.Close(mappingName)
+		if closeErr != nil {
+			hbm.logger.Error("FSHostBindMounts", "Failed closing LUKS mapping '%s': %s", mappingName, closeErr.Error())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// mountBlockDevice mounts filesystem of a block device at given path
+func (hbm FSHostBindMounts) mountBlockDevice(path, device string, readOnly bool) error {
+	err := hbm.fs.MkdirAll(path, os.FileMode(0755))
+	if err != nil {
+		return bosherr.WrapError(err, "Making disk specific persistent bind mount")
+	}
+
+	mountOpts := "rw"
+	if readOnly {
+		mountOpts = "ro"
+	}
+
+	_, _, _, err = hbm.cmdRunner.RunCommand("mount", device, path, "-o", mountOpts)
+	if err != nil {
+		return bosherr.WrapError(err, "Mounting disk specific persistent bind mount")
+	}
+
+	return nil
+}
+
+// mappingName identifies LUKS mapping of a disk attached to a VM;
+// read-only disks attached to several VMs are opened once per VM
+func (hbm FSHostBindMounts) mappingName(path string) string {
+	return "bwc-" + filepath.Base(filepath.Dir(path)) + "-" + filepath.Base(path)
+}
+
+// mountDirectory bind mounts directory disk; read-only bind mounts
+// have to be remounted since mount ignores ro when binding
+func (hbm FSHostBindMounts) mountDirectory(path, diskPath string, readOnly bool) error {
+	err := hbm.fs.MkdirAll(path, os.FileMode(0755))
+	if err != nil {
+		return bosherr.WrapError(err, "Making disk specific persistent bind mount")
+	}
+
+	_, _, _, err = hbm.cmdRunner.RunCommand("mount", "--bind", diskPath, path)
+	if err != nil {
+		return bosherr.WrapError(err, "Mounting disk specific persistent bind mount")
+	}
+
+	if readOnly {
+		_, _, _, err = hbm.cmdRunner.RunCommand("mount", "-o", "remount,bind,ro", path)
+		if err != nil {
+			// Do not leave disk writable when it was requested read-only
+			_, _, _, umountErr := hbm.cmdRunner.RunCommand("umount", path)
+			if umountErr != nil {
+				hbm.logger.Error("FSHostBindMounts", "Failed unmounting '%s': %s", path, umountErr.Error())
+			}
+
+			return bosherr.WrapError(err, "Remounting disk specific persistent bind mount read-only")
+		}
+	}
+
+	return nil
+}
+
+// mountDevice attaches disk image to a loop device and bind mounts that device
+// node onto a file in the shared persistent bind mounts dir so that it
+// propagates into the container where the agent partitions and formats it.
+func (hbm FSHostBindMounts) mountDevice(path, diskPath string, readOnly bool) error {
+	losetupArgs := []string{"--find", "--show", diskPath}
+	if readOnly {
+		losetupArgs = append([]string{"--read-only"}, losetupArgs...)
+	}
+
+	stdout, _, _, err := hbm.cmdRunner.RunCommand("losetup", losetupArgs...)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Attaching loop device for '%s'", diskPath)
+	}
+
+	device := strings.TrimSpace(stdout)
+
+	err = hbm.bindDevice(path, device)
+	if err != nil {
+		hbm.detachLoopDevice(device)
+		return err
+	}
+
+	return nil
+}
+
+// bindDevice bind mounts device node onto a file at given path
+func (hbm FSHostBindMounts) bindDevice(path, device string) error {
+	err := hbm.fs.MkdirAll(filepath.Dir(path), os.FileMode(0755))
+	if err != nil {
+		return bosherr.WrapError(err, "Making persistent bind mounts dir")
+	}
+
+	err = hbm.fs.WriteFile(path, []byte{})
+	if err != nil {
+		return bosherr.WrapError(err, "Making disk specific device bind mount")
+	}
+
+	_, _, _, err = hbm.cmdRunner.RunCommand("mount", "--bind", device, path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Bind mounting device '%s'", device)
+	}
+
+	return nil
+}
+
+func (hbm FSHostBindMounts) checkNotAttachedElsewhere(id apiv1.VMCID, diskID apiv1.DiskCID) error {
+	paths, err := hbm.fs.Glob(filepath.Join(hbm.persistentBindMountsDir, "*", diskID.AsString()))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Finding other attachments of disk '%s'", diskID.AsString())
+	}
+
+	var otherPaths []string
+
+	for _, path := range paths {
+		vmID := filepath.Base(filepath.Dir(path))
+		if vmID != id.AsString() {
+			otherPaths = append(otherPaths, path)
+		}
+	}
+
+	if len(otherPaths) == 0 {
+		return nil
+	}
+
+	stdout, _, _, err := hbm.cmdRunner.RunCommand("mount")
+	if err != nil {
+		return bosherr.WrapError(err, "Checking persistent bind mounts")
+	}
+
+	for _, path := range otherPaths {
+		if strings.Contains(stdout, " on "+path+" ") {
+			return bosherr.Errorf(
+				"Disk '%s' is already attached to VM '%s'; only read-only disks can be attached to several VMs",
+				diskID.AsString(), filepath.Base(filepath.Dir(path)))
+		}
+	}
+
+	return nil
+}
+
+// unmountDiskPath closes LUKS mapping of encrypted disks once they are unmounted
+func (hbm FSHostBindMounts) unmountDiskPath(path string, encrypted bool) error {
+	err := hbm.unmountDiskPathOnly(path)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		return hbm.luks.Close(hbm.mappingName(path))
+	}
+
+	return nil
+}
+
+// hasMapping tells whether LUKS mapping of disk attached at path is open
+func (hbm FSHostBindMounts) hasMapping(path string) bool {
+	return hbm.luks.Enabled() && hbm.fs.FileExists(filepath.Join("/dev/mapper", hbm.mappingName(path)))
+}
+
+func (hbm FSHostBindMounts) unmountDiskPathOnly(path string) error {
+	if !hbm.attachAsBlockDevices {
+		return hbm.unmountPath(path)
+	}
+
+	// Loop device has to be looked up before its bind mount goes away
+	device := hbm.boundLoopDevice(path)
+
+	err := hbm.unmountPath(path)
+	if err != nil {
+		return err
+	}
+
+	if device != "" {
+		hbm.detachLoopDevice(device)
+	}
+
+	return nil
+}
+
+// boundLoopDevice returns loop device bind mounted at given path or empty string.
+// Device nodes bind mounted from devtmpfs report their node path as FSROOT.
+func (hbm FSHostBindMounts) boundLoopDevice(path string) string {
+	stdout, _, _, err := hbm.cmdRunner.RunCommand(
+		"findmnt", "--noheadings", "--output", "FSROOT", "--mountpoint", path)
+	if err != nil {
+		return ""
+	}
+
+	fsRoot := strings.TrimSpace(stdout)
+
+	if !strings.HasPrefix(fsRoot, "/loop") {
+		return ""
+	}
+
+	return filepath.Join("/dev", fsRoot)
+}
+
+func (hbm FSHostBindMounts) detachLoopDevice(device string) {
+	_, _, _, err := hbm.cmdRunner.RunCommand("losetup", "--detach", device)
+	if err != nil {
+		hbm.logger.Error("FSHostBindMounts", "Failed detaching loop device '%s': %s", device, err.Error())
+	}
 }
 
 func (hbm FSHostBindMounts) unmountPath(path string) error {
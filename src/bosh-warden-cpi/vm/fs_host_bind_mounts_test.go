@@ -10,6 +10,8 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	bwcdisk "bosh-warden-cpi/disk"
+	fakedisk "bosh-warden-cpi/disk/fakes"
 	bwcutil "bosh-warden-cpi/util"
 	. "bosh-warden-cpi/vm"
 )
@@ -31,6 +33,8 @@ var _ = Describe("FSHostBindMounts", func() {
 		hostBindMounts = NewFSHostBindMounts(
 			"/fake-ephemeral-dir",
 			"/fake-persistent-dir",
+			false,
+			"",
 			sleeper,
 			fs,
 			cmdRunner,
@@ -319,6 +323,28 @@ var _ = Describe("FSHostBindMounts", func() {
 				}))
 			})
 
+			It("closes only LUKS mappings that are open when disks are encrypted", func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir", "/fake-persistent-dir", false, "/fake-key-file",
+					sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+				err := fs.WriteFileString("/dev/mapper/bwc-fake-id-fake-disk-id-2", "")
+				Expect(err).ToNot(HaveOccurred())
+
+				err = hostBindMounts.DeletePersistent(apiv1.NewVMCID("fake-id"))
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount"},
+					[]string{"umount", "/fake-persistent-dir/fake-id/fake-disk-id-1"},
+					[]string{"mount"},
+					[]string{"umount", "/fake-persistent-dir/fake-id/fake-disk-id-2"},
+					[]string{"cryptsetup", "status", "bwc-fake-id-fake-disk-id-2"},
+					[]string{"cryptsetup", "close", "bwc-fake-id-fake-disk-id-2"},
+					[]string{"umount", "/fake-persistent-dir/fake-id"},
+				}))
+			})
+
 			Context("when getting mounted disk paths fails", func() {
 				BeforeEach(func() {
 					fs.GlobErr = errors.New("fake-glob-error")
@@ -405,8 +431,16 @@ var _ = Describe("FSHostBindMounts", func() {
 	})
 
 	Describe("MountPersistent", func() {
+		var (
+			disk *fakedisk.FakeDisk
+		)
+
+		BeforeEach(func() {
+			disk = fakedisk.NewFakeDiskWithPath(apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+		})
+
 		It("creates directory for mount point for that requested id and disk id", func() {
-			err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+			err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
 			Expect(err).ToNot(HaveOccurred())
 
 			pathStat := fs.GetFileTestStat("/fake-persistent-dir/fake-id/fake-disk-id")
@@ -416,7 +450,7 @@ var _ = Describe("FSHostBindMounts", func() {
 
 		Context("when creating directory succeeds", func() {
 			It("mounts disk path as a loop back device", func() {
-				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(cmdRunner.RunCommands).To(HaveLen(1))
@@ -425,6 +459,69 @@ var _ = Describe("FSHostBindMounts", func() {
 				))
 			})
 
+			It("mounts read-only disk path as a read-only loop back device", func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", bwcdisk.DiskProps{ReadOnly: true})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "/fake-disk-path", "/fake-persistent-dir/fake-id/fake-disk-id", "-o", "loop,ro"},
+				}))
+			})
+
+			Context("when disk is already attached to another VM", func() {
+				BeforeEach(func() {
+					fs.SetGlob("/fake-persistent-dir/*/fake-disk-id", []string{
+						"/fake-persistent-dir/fake-id/fake-disk-id",
+						"/fake-persistent-dir/fake-other-id/fake-disk-id",
+					})
+
+					cmdRunner.AddCmdResult("mount", fakesys.FakeCmdResult{
+						Stdout: "/dev/loop3 on /fake-persistent-dir/fake-other-id/fake-disk-id type ext4 (rw)",
+					})
+				})
+
+				It("returns error for read-write disk without mounting it", func() {
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("Disk 'fake-disk-id' is already attached to VM 'fake-other-id'"))
+
+					Expect(cmdRunner.RunCommands).To(Equal([][]string{[]string{"mount"}}))
+				})
+
+				It("mounts read-only disk", func() {
+					disk = fakedisk.NewFakeDiskWithProps(
+						apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", bwcdisk.DiskProps{ReadOnly: true})
+
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+					Expect(err).ToNot(HaveOccurred())
+				})
+			})
+
+			Context("when disk was attached to another VM but is no longer mounted", func() {
+				BeforeEach(func() {
+					fs.SetGlob("/fake-persistent-dir/*/fake-disk-id", []string{
+						"/fake-persistent-dir/fake-other-id/fake-disk-id",
+					})
+
+					cmdRunner.AddCmdResult("mount", fakesys.FakeCmdResult{
+						Stdout: "/dev/sda1 on / type ext4 (rw)",
+					})
+				})
+
+				It("mounts read-write disk", func() {
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(cmdRunner.RunCommands).To(Equal([][]string{
+						[]string{"mount"},
+						[]string{"mount", "/fake-disk-path", "/fake-persistent-dir/fake-id/fake-disk-id", "-o", "loop"},
+					}))
+				})
+			})
+
 			Context("when mounting fails", func() {
 				It("returns error", func() {
 					cmdRunner.AddCmdResult(
@@ -432,7 +529,7 @@ var _ = Describe("FSHostBindMounts", func() {
 						fakesys.FakeCmdResult{Error: errors.New("fake-run-err")},
 					)
 
-					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
 					Expect(err).To(HaveOccurred())
 					Expect(err.Error()).To(ContainSubstring("fake-run-err"))
 				})
@@ -445,27 +542,359 @@ var _ = Describe("FSHostBindMounts", func() {
 			})
 
 			It("returns error if creating directory fails", func() {
-				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("fake-mkdir-all-err"))
 			})
 
 			It("does not run any mount comamnds (also implies that mount runs after creating dir)", func() {
-				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
 				Expect(err).To(HaveOccurred())
 				Expect(cmdRunner.RunCommands).To(BeEmpty())
 			})
 		})
+
+		Context("when disk is a directory", func() {
+			BeforeEach(func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeDirectory})
+			})
+
+			It("bind mounts tmpfs disk directory", func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeTmpfs})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "--bind", "/fake-disk-path", "/fake-persistent-dir/fake-id/fake-disk-id"},
+				}))
+			})
+
+			It("bind mounts disk directory without loop device", func() {
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				pathStat := fs.GetFileTestStat("/fake-persistent-dir/fake-id/fake-disk-id")
+				Expect(pathStat.FileType).To(Equal(fakesys.FakeFileTypeDir))
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "--bind", "/fake-disk-path", "/fake-persistent-dir/fake-id/fake-disk-id"},
+				}))
+			})
+
+			It("remounts read-only disk directory as read-only", func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeDirectory, ReadOnly: true})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "--bind", "/fake-disk-path", "/fake-persistent-dir/fake-id/fake-disk-id"},
+					[]string{"mount", "-o", "remount,bind,ro", "/fake-persistent-dir/fake-id/fake-disk-id"},
+				}))
+			})
+
+			It("unmounts disk directory if remounting it read-only fails", func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeDirectory, ReadOnly: true})
+
+				cmdRunner.AddCmdResult(
+					"mount -o remount,bind,ro /fake-persistent-dir/fake-id/fake-disk-id",
+					fakesys.FakeCmdResult{Error: errors.New("fake-remount-err")},
+				)
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-remount-err"))
+
+				Expect(cmdRunner.RunCommands[2]).To(Equal(
+					[]string{"umount", "/fake-persistent-dir/fake-id/fake-disk-id"}))
+			})
+
+			It("returns error if disks are attached as block devices", func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir", "/fake-persistent-dir", true, "",
+					sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("directory disk 'fake-disk-id' cannot be attached as a block device"))
+
+				Expect(cmdRunner.RunCommands).To(BeEmpty())
+			})
+		})
+
+		Context("when disk is encrypted", func() {
+			BeforeEach(func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir", "/fake-persistent-dir", false, "/fake-key-file",
+					sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", bwcdisk.DiskProps{Encrypted: true})
+			})
+
+			It("opens LUKS container and mounts mapped device", func() {
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"cryptsetup", "open", "--type", "luks", "--key-file", "/fake-key-file",
+						"/fake-disk-path", "bwc-fake-id-fake-disk-id"},
+					[]string{"mount", "/dev/mapper/bwc-fake-id-fake-disk-id", "/fake-persistent-dir/fake-id/fake-disk-id", "-o", "rw"},
+				}))
+			})
+
+			It("opens LUKS container of read-only disk read-only", func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", bwcdisk.DiskProps{Encrypted: true, ReadOnly: true})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands[0]).To(ContainElement("--readonly"))
+				Expect(cmdRunner.RunCommands[1]).To(ContainElement("ro"))
+			})
+
+			It("closes LUKS container if mounting mapped device fails", func() {
+				cmdRunner.AddCmdResult(
+					"mount /dev/mapper/bwc-fake-id-fake-disk-id /fake-persistent-dir/fake-id/fake-disk-id -o rw",
+					fakesys.FakeCmdResult{Error: errors.New("fake-mount-err")},
+				)
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-mount-err"))
+
+				Expect(cmdRunner.RunCommands[3]).To(Equal([]string{"cryptsetup", "close", "bwc-fake-id-fake-disk-id"}))
+			})
+
+			It("returns error if opening LUKS container fails", func() {
+				cmdRunner.AddCmdResult(
+					"cryptsetup open --type luks --key-file /fake-key-file /fake-disk-path bwc-fake-id-fake-disk-id",
+					fakesys.FakeCmdResult{Error: errors.New("fake-open-err")},
+				)
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-open-err"))
+				Expect(cmdRunner.RunCommands).To(HaveLen(1))
+			})
+
+			It("bind mounts mapped device when disks are attached as block devices", func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir", "/fake-persistent-dir", true, "/fake-key-file",
+					sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands[1]).To(Equal([]string{
+					"mount", "--bind", "/dev/mapper/bwc-fake-id-fake-disk-id", "/fake-persistent-dir/fake-id/fake-disk-id"}))
+			})
+		})
+
+		Context("when disk is a logical volume", func() {
+			BeforeEach(func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/dev/fake-vg/fake-lv",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeLVM})
+			})
+
+			It("mounts volume without loop device", func() {
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "/dev/fake-vg/fake-lv", "/fake-persistent-dir/fake-id/fake-disk-id", "-o", "rw"},
+				}))
+			})
+
+			It("mounts read-only volume as read-only", func() {
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/dev/fake-vg/fake-lv",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeLVM, ReadOnly: true})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "/dev/fake-vg/fake-lv", "/fake-persistent-dir/fake-id/fake-disk-id", "-o", "ro"},
+				}))
+			})
+
+			It("bind mounts volume device without loop device when disks are attached as block devices", func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir", "/fake-persistent-dir", true, "",
+					sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"mount", "--bind", "/dev/fake-vg/fake-lv", "/fake-persistent-dir/fake-id/fake-disk-id"},
+				}))
+			})
+
+			It("attaches read-only volume to read-only loop device when disks are attached as block devices", func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir", "/fake-persistent-dir", true, "",
+					sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+				disk = fakedisk.NewFakeDiskWithProps(
+					apiv1.NewDiskCID("fake-disk-id"), "/dev/fake-vg/fake-lv",
+					bwcdisk.DiskProps{Type: bwcdisk.DiskTypeLVM, ReadOnly: true})
+
+				cmdRunner.AddCmdResult("losetup --read-only --find --show /dev/fake-vg/fake-lv", fakesys.FakeCmdResult{
+					Stdout: "/dev/loop7\n",
+				})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"losetup", "--read-only", "--find", "--show", "/dev/fake-vg/fake-lv"},
+					[]string{"mount", "--bind", "/dev/loop7", "/fake-persistent-dir/fake-id/fake-disk-id"},
+				}))
+			})
+		})
+
+		Context("when disks are attached as block devices", func() {
+			BeforeEach(func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir",
+					"/fake-persistent-dir",
+					true,
+					"",
+					sleeper,
+					fs,
+					cmdRunner,
+					boshlog.NewLogger(boshlog.LevelNone),
+				)
+			})
+
+			Context("when attaching loop device succeeds", func() {
+				BeforeEach(func() {
+					cmdRunner.AddCmdResult("losetup --find --show /fake-disk-path", fakesys.FakeCmdResult{
+						Stdout: "/dev/loop7\n",
+					})
+				})
+
+				It("creates file for device mount point for that requested id and disk id", func() {
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+					Expect(err).ToNot(HaveOccurred())
+
+					pathStat := fs.GetFileTestStat("/fake-persistent-dir/fake-id/fake-disk-id")
+					Expect(pathStat.FileType).To(Equal(fakesys.FakeFileTypeFile))
+				})
+
+				It("attaches disk path to a loop device and bind mounts that device", func() {
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(cmdRunner.RunCommands).To(Equal([][]string{
+						[]string{"losetup", "--find", "--show", "/fake-disk-path"},
+						[]string{"mount", "--bind", "/dev/loop7", "/fake-persistent-dir/fake-id/fake-disk-id"},
+					}))
+				})
+
+				It("detaches loop device if bind mounting it fails", func() {
+					cmdRunner.AddCmdResult(
+						"mount --bind /dev/loop7 /fake-persistent-dir/fake-id/fake-disk-id",
+						fakesys.FakeCmdResult{Error: errors.New("fake-mount-err")},
+					)
+
+					err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-mount-err"))
+
+					Expect(cmdRunner.RunCommands[2]).To(Equal([]string{"losetup", "--detach", "/dev/loop7"}))
+				})
+			})
+
+			It("returns error if attaching loop device fails", func() {
+				cmdRunner.AddCmdResult("losetup --find --show /fake-disk-path", fakesys.FakeCmdResult{
+					Error: errors.New("fake-losetup-err"),
+				})
+
+				err := hostBindMounts.MountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-losetup-err"))
+			})
+		})
 	})
 
 	Describe("UnmountPersistent", func() {
+		var disk *fakedisk.FakeDisk
+
+		BeforeEach(func() {
+			disk = fakedisk.NewFakeDiskWithPath(apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path")
+		})
+
+		It("closes LUKS mapping of encrypted disk after unmounting it", func() {
+			hostBindMounts = NewFSHostBindMounts(
+				"/fake-ephemeral-dir", "/fake-persistent-dir", false, "/fake-key-file",
+				sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+			disk = fakedisk.NewFakeDiskWithProps(
+				apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", bwcdisk.DiskProps{Encrypted: true})
+
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				[]string{"mount"},
+				[]string{"cryptsetup", "status", "bwc-fake-id-fake-disk-id"},
+				[]string{"cryptsetup", "close", "bwc-fake-id-fake-disk-id"},
+			}))
+		})
+
+		It("never closes LUKS mapping of unencrypted disk", func() {
+			hostBindMounts = NewFSHostBindMounts(
+				"/fake-ephemeral-dir", "/fake-persistent-dir", false, "/fake-key-file",
+				sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(Equal([][]string{
+				[]string{"mount"},
+			}))
+		})
+
+		It("does not close LUKS mapping that is not open", func() {
+			hostBindMounts = NewFSHostBindMounts(
+				"/fake-ephemeral-dir", "/fake-persistent-dir", false, "/fake-key-file",
+				sleeper, fs, cmdRunner, boshlog.NewLogger(boshlog.LevelNone))
+
+			disk = fakedisk.NewFakeDiskWithProps(
+				apiv1.NewDiskCID("fake-disk-id"), "/fake-disk-path", bwcdisk.DiskProps{Encrypted: true})
+
+			cmdRunner.AddCmdResult("cryptsetup status bwc-fake-id-fake-disk-id", fakesys.FakeCmdResult{
+				ExitStatus: 4,
+				Error:      errors.New("fake-status-err"),
+			})
+
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cmdRunner.RunCommands).To(HaveLen(2))
+		})
+
 		It("unmounts disk path if disk path is mounted", func() {
 			cmdRunner.AddCmdResult("mount", fakesys.FakeCmdResult{
 				Stdout: `/dev/sda1 on / type ext4 (rw)
 /fake-persistent-dir/fake-id/fake-disk-id on /fake-disk-path type none (rw,bind)`,
 			})
 
-			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"))
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(cmdRunner.RunCommands).To(HaveLen(2))
@@ -480,7 +909,7 @@ var _ = Describe("FSHostBindMounts", func() {
 				Stdout: "/dev/sda1 on / type ext4 (rw)",
 			})
 
-			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"))
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(cmdRunner.RunCommands).To(HaveLen(1))
@@ -492,7 +921,7 @@ var _ = Describe("FSHostBindMounts", func() {
 				Error: errors.New("fake-run-err"),
 			})
 
-			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"))
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("fake-run-err"))
 
@@ -521,7 +950,7 @@ var _ = Describe("FSHostBindMounts", func() {
 				fakesys.FakeCmdResult{},
 			)
 
-			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"))
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
 			Expect(err).ToNot(HaveOccurred())
 
 			// Mount check and unmount operations performed
@@ -554,7 +983,7 @@ var _ = Describe("FSHostBindMounts", func() {
 				)
 			}
 
-			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), apiv1.NewDiskCID("fake-disk-id"))
+			err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("fake-run-err"))
 
@@ -567,5 +996,53 @@ var _ = Describe("FSHostBindMounts", func() {
 				))
 			}
 		})
+
+		Context("when disks are attached as block devices", func() {
+			BeforeEach(func() {
+				hostBindMounts = NewFSHostBindMounts(
+					"/fake-ephemeral-dir",
+					"/fake-persistent-dir",
+					true,
+					"",
+					sleeper,
+					fs,
+					cmdRunner,
+					boshlog.NewLogger(boshlog.LevelNone),
+				)
+			})
+
+			It("unmounts device and detaches loop device that was bind mounted", func() {
+				cmdRunner.AddCmdResult(
+					"findmnt --noheadings --output FSROOT --mountpoint /fake-persistent-dir/fake-id/fake-disk-id",
+					fakesys.FakeCmdResult{Stdout: "/loop7\n"},
+				)
+				cmdRunner.AddCmdResult("mount", fakesys.FakeCmdResult{
+					Stdout: "udev on /fake-persistent-dir/fake-id/fake-disk-id type devtmpfs (rw)",
+				})
+
+				err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(Equal([][]string{
+					[]string{"findmnt", "--noheadings", "--output", "FSROOT", "--mountpoint", "/fake-persistent-dir/fake-id/fake-disk-id"},
+					[]string{"mount"},
+					[]string{"umount", "/fake-persistent-dir/fake-id/fake-disk-id"},
+					[]string{"losetup", "--detach", "/dev/loop7"},
+				}))
+			})
+
+			It("does not detach anything if nothing is mounted", func() {
+				cmdRunner.AddCmdResult(
+					"findmnt --noheadings --output FSROOT --mountpoint /fake-persistent-dir/fake-id/fake-disk-id",
+					fakesys.FakeCmdResult{Error: errors.New("fake-not-found-err")},
+				)
+
+				err := hostBindMounts.UnmountPersistent(apiv1.NewVMCID("fake-id"), disk)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cmdRunner.RunCommands).To(HaveLen(2))
+				Expect(cmdRunner.RunCommands[1]).To(Equal([]string{"mount"}))
+			})
+		})
 	})
 })
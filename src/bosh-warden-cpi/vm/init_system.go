@@ -0,0 +1,84 @@
+package vm
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+
+	bwcstem "bosh-warden-cpi/stemcell"
+)
+
+// InitSystem determines how BOSH Agent is started in container
+type InitSystem string
+
+const (
+	// Container runs Garden's init and agent is started with runsvdir
+	InitSystemRunit InitSystem = "runit"
+
+	// Container runs /sbin/init of stemcell which starts agent itself
+	InitSystemSystemD InitSystem = "systemd"
+)
+
+// InitSystemEnvVar tells init wrapper installed by warden_cpi job
+// which init system to exec as container's PID 1
+const InitSystemEnvVar = "BOSH_INIT_SYSTEM"
+
+const (
+	// Garden's own init binary on the host
+	gardenInitPath = "/var/vcap/data/garden/bin/init"
+
+	// Init wrapper execs Garden's init from here for runit containers
+	containerGardenInitPath = "/tmp/garden-default-init"
+)
+
+// runitOperatingSystems lists stemcell operating systems that predate
+// systemd stemcells; newer operating systems are started with systemd
+var runitOperatingSystems = map[string]bool{
+	"ubuntu-trusty": true,
+	"ubuntu-xenial": true,
+	"ubuntu-bionic": true,
+	"ubuntu-jammy":  true,
+}
+
+// NewInitSystemFromString returns empty InitSystem for empty string
+func NewInitSystemFromString(str string) (InitSystem, error) {
+	switch initSystem := InitSystem(str); initSystem {
+	case "", InitSystemRunit, InitSystemSystemD:
+		return initSystem, nil
+	default:
+		return "", bosherr.Errorf("Expected init system to be '%s' or '%s' but was '%s'",
+			InitSystemRunit, InitSystemSystemD, str)
+	}
+}
+
+// selectInitSystem picks init system from VM cloud properties, then stemcell metadata
+// and then stemcell operating system; stemcells without metadata use systemdByDefault
+func selectInitSystem(stemcell bwcstem.Stemcell, props VMProps, systemdByDefault bool) (InitSystem, error) {
+	if props.InitSystem != "" {
+		return props.InitSystem, nil
+	}
+
+	metadata, err := stemcell.Metadata()
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Reading metadata of stemcell '%s'", stemcell.ID())
+	}
+
+	if metadata != nil {
+		initSystem, err := NewInitSystemFromString(metadata.GetInitSystem())
+		if err != nil {
+			return "", bosherr.WrapErrorf(err, "Validating init system of stemcell '%s'", stemcell.ID())
+		}
+
+		if initSystem != "" {
+			return initSystem, nil
+		}
+
+		if runitOperatingSystems[metadata.OperatingSystem] {
+			return InitSystemRunit, nil
+		}
+	}
+
+	if systemdByDefault {
+		return InitSystemSystemD, nil
+	}
+
+	return InitSystemRunit, nil
+}
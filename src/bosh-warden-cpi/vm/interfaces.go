@@ -11,8 +11,19 @@ type Creator interface {
 	Create(apiv1.AgentID, bwcstem.Stemcell, VMProps, apiv1.Networks, apiv1.VMEnv) (VM, error)
 }
 
+// StemcellCIDProperty is the container property that records which stemcell a VM was created from
+const StemcellCIDProperty = "bosh.stemcell_cid"
+
+// StemcellImageProperty is the container property that records which image a VM uses
+// as its rootfs; identical stemcells imported under several CIDs share one image
+const StemcellImageProperty = "bosh.stemcell_image"
+
 type Finder interface {
 	Find(apiv1.VMCID) (VM, bool, error)
+
+	// FindByStemcell returns IDs of VMs created from the stemcell
+	// or from any other stemcell sharing its image
+	FindByStemcell(bwcstem.Stemcell) ([]apiv1.VMCID, error)
 }
 
 type VM interface {
@@ -26,6 +37,9 @@ type VM interface {
 
 type VMProps struct {
 	PortMappings []PortMapping
+
+	// Overrides init system selected based on stemcell when set
+	InitSystem InitSystem
 }
 
 type Ports interface {
@@ -47,6 +61,7 @@ type GuestBindMounts interface {
 	MakeEphemeral() string
 	MakePersistent() string
 	MountPersistent(apiv1.DiskCID) string
+	PersistentDiskHint(apiv1.DiskCID) apiv1.DiskHint
 }
 
 type HostBindMounts interface {
@@ -56,8 +71,8 @@ type HostBindMounts interface {
 	MakePersistent(apiv1.VMCID) (string, error)
 	DeletePersistent(apiv1.VMCID) error
 
-	MountPersistent(apiv1.VMCID, apiv1.DiskCID, string) error
-	UnmountPersistent(apiv1.VMCID, apiv1.DiskCID) error
+	MountPersistent(apiv1.VMCID, bwcdisk.Disk) error
+	UnmountPersistent(apiv1.VMCID, bwcdisk.Disk) error
 }
 
 type MetadataService interface {
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"io"
 	"strings"
 
 	wrdn "code.cloudfoundry.org/garden"
@@ -11,6 +12,7 @@ import (
 
 	"bosh-warden-cpi/config"
 	bwcstem "bosh-warden-cpi/stemcell"
+	bwcutil "bosh-warden-cpi/util"
 )
 
 type WardenCreator struct {
@@ -26,6 +28,8 @@ type WardenCreator struct {
 
 	systemResolvConfProvider func() (ResolvConf, error)
 
+	clock bwcutil.Clock
+
 	agentOptions apiv1.AgentOptions
 	logger       boshlog.Logger
 	Config       config.Config
@@ -40,6 +44,7 @@ func NewWardenCreator(
 	hostBindMounts HostBindMounts,
 	guestBindMounts GuestBindMounts,
 	systemResolvConfProvider func() (ResolvConf, error),
+	clock bwcutil.Clock,
 	agentOptions apiv1.AgentOptions,
 	logger boshlog.Logger,
 	config config.Config,
@@ -58,6 +63,8 @@ func NewWardenCreator(
 
 		systemResolvConfProvider: systemResolvConfProvider,
 
+		clock: clock,
+
 		agentOptions: agentOptions,
 		logger:       logger,
 	}
@@ -90,6 +97,19 @@ func (c WardenCreator) Create(
 		net.SetPreconfigured()
 	}
 
+	initSystem, err := selectInitSystem(stemcell, props, c.Config.StartContainersWithSystemD)
+	if err != nil {
+		return WardenVM{}, bosherr.WrapError(err, "Selecting init system")
+	}
+
+	// Only init wrapper installed by warden_cpi job can run /sbin/init as PID 1
+	if initSystem == InitSystemSystemD && !c.Config.StartContainersWithSystemD {
+		return WardenVM{}, bosherr.Errorf(
+			"Starting containers with systemd requires warden_cpi.start_containers_with_systemd to be enabled")
+	}
+
+	c.logger.Debug("WardenCreator", "Starting VM '%s' with init system '%s'", id, initSystem)
+
 	hostEphemeralBindMountPath, hostPersistentBindMountsDir, err := c.makeHostBindMounts(id)
 	if err != nil {
 		return WardenVM{}, err
@@ -97,7 +117,7 @@ func (c WardenCreator) Create(
 
 	containerSpec := wrdn.ContainerSpec{
 		Handle:  id.AsString(),
-		Image:   wrdn.ImageRef{URI: stemcell.URI()},
+		Image:   c.imageRef(stemcell.URI()),
 		Network: networkIPCIDR,
 		BindMounts: []wrdn.BindMount{
 			wrdn.BindMount{
@@ -113,24 +133,50 @@ func (c WardenCreator) Create(
 				Origin:  wrdn.BindMountOriginHost,
 			},
 		},
-		Properties: wrdn.Properties{},
+		Properties: wrdn.Properties{
+			StemcellCIDProperty:   stemcell.ID().AsString(),
+			StemcellImageProperty: stemcell.URI(),
+		},
 		Privileged: true,
 	}
 
 	if c.Config.StartContainersWithSystemD {
+		containerSpec.Env = append(containerSpec.Env, InitSystemEnvVar+"="+string(initSystem))
+	}
+
+	switch {
+	case initSystem == InitSystemSystemD:
 		containerSpec.BindMounts = append(containerSpec.BindMounts, wrdn.BindMount{
 			SrcPath: "/sys/fs/cgroup",
 			DstPath: "/sys/fs/cgroup",
 			Mode:    wrdn.BindMountModeRW,
 			Origin:  wrdn.BindMountOriginHost,
 		})
+
+	case c.Config.StartContainersWithSystemD:
+		// Init wrapper falls back to Garden's init which is not otherwise visible in container
+		containerSpec.BindMounts = append(containerSpec.BindMounts, wrdn.BindMount{
+			SrcPath: gardenInitPath,
+			DstPath: containerGardenInitPath,
+			Mode:    wrdn.BindMountModeRO,
+			Origin:  wrdn.BindMountOriginHost,
+		})
 	}
 
-	c.logger.Debug("WardenCreator", "Creating container with spec %#v", containerSpec)
+	if metadata, err := stemcell.Metadata(); err == nil && metadata != nil {
+		c.logger.Debug("WardenCreator", "Creating VM '%s' from stemcell '%s' (%s)", id, stemcell.ID(), metadata)
+	}
+
+	loggedSpec := containerSpec
+	if loggedSpec.Image.Password != "" {
+		loggedSpec.Image.Password = "<redacted>"
+	}
+
+	c.logger.Debug("WardenCreator", "Creating container with spec %#v", loggedSpec)
 
-	container, err := c.wardenClient.Create(containerSpec)
+	container, err := c.createContainer(stemcell, containerSpec)
 	if err != nil {
-		return WardenVM{}, bosherr.WrapError(err, "Creating container")
+		return WardenVM{}, err
 	}
 
 	info, err := container.Info()
@@ -163,17 +209,29 @@ func (c WardenCreator) Create(
 		return WardenVM{}, bosherr.WrapError(err, "Updating container's metadata")
 	}
 
-	if c.Config.StartContainersWithSystemD {
-		err = c.prepareContainer(container)
-		if err != nil {
-			c.cleanUpContainer(container)
-			return WardenVM{}, err
-		}
-	} else {
-		err = c.startAgentInContainer(container)
+	bootstrapParams := BootstrapScriptParams{
+		VMCID:       id.AsString(),
+		AgentID:     agentID.AsString(),
+		StemcellCID: stemcell.ID().AsString(),
+		InitSystem:  initSystem,
+	}
+
+	if metadata, err := stemcell.Metadata(); err == nil && metadata != nil {
+		bootstrapParams.OperatingSystem = metadata.OperatingSystem
+		bootstrapParams.StemcellVersion = metadata.Version
+	}
+
+	bootstrap, bootstrapStderr, err := c.bootstrapContainer(container, bootstrapParams)
+	if err != nil {
+		c.cleanUpContainer(container)
+		return WardenVM{}, err
+	}
+
+	if c.Config.Actions.AgentReadinessTimeout > 0 {
+		err = c.waitForAgent(container, bootstrap, bootstrapStderr, initSystem)
 		if err != nil {
 			c.cleanUpContainer(container)
-			return WardenVM{}, err
+			return WardenVM{}, bosherr.WrapError(err, "Waiting for BOSH Agent to start")
 		}
 	}
 
@@ -214,50 +272,61 @@ func (c WardenCreator) makeHostBindMounts(id apiv1.VMCID) (string, string, error
 	return ephemeralBindMountPath, persistentBindMountsDir, nil
 }
 
-func (c WardenCreator) startAgentInContainer(container wrdn.Container) error {
+// bootstrapContainer runs bootstrap script of stemcell that starts BOSH Agent
+// either directly or by preparing container for systemd to start it
+func (c WardenCreator) bootstrapContainer(
+	container wrdn.Container, params BootstrapScriptParams) (wrdn.Process, *capturedOutput, error) {
+
+	script, err := renderBootstrapScript(c.Config.Actions.BootstrapScripts, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	processSpec := wrdn.ProcessSpec{
 		Path: "/bin/bash",
 		User: "root",
-		Args: []string{
-			"-c",
-			strings.Join([]string{
-				"umount /etc/resolv.conf",
-				"umount /etc/hosts",
-				"umount /etc/hostname",
-				"rm -rf /var/vcap/data/sys",
-				"mkdir -p /var/vcap/data/sys",
-				"sed -i 's/chronyc/# chronyc/g' /var/vcap/bosh/bin/sync-time",
-				"exec env -i /usr/sbin/runsvdir-start",
-			}, "\n"),
-		},
+		Args: []string{"-c", script},
+	}
+
+	logOutput := func(stream string) *processLogWriter {
+		return &processLogWriter{logLine: func(line string) {
+			c.logger.Debug("WardenCreator", "Bootstrap script of VM '%s' %s: %s", params.VMCID, stream, line)
+		}}
+	}
+
+	stderr := &capturedOutput{}
+
+	processIO := wrdn.ProcessIO{
+		Stdout: logOutput("stdout"),
+		Stderr: io.MultiWriter(logOutput("stderr"), stderr),
 	}
 
 	// Do not Wait() for the process to finish
-	_, err := container.Run(processSpec, wrdn.ProcessIO{})
+	process, err := container.Run(processSpec, processIO)
 	if err != nil {
-		return bosherr.WrapError(err, "Running BOSH Agent in container")
+		return nil, nil, bosherr.WrapError(err, "Running bootstrap script to start BOSH Agent in container")
 	}
 
-	return nil
+	return process, stderr, nil
 }
 
-func (c WardenCreator) prepareContainer(container wrdn.Container) error {
-	processSpec := wrdn.ProcessSpec{
-		Path: "/bin/bash",
-		User: "root",
-		Args: []string{
-			"-c",
-			"umount /etc/hosts",
-		},
+// imageRef authenticates pulls from registries that have configured credentials
+func (c WardenCreator) imageRef(uri string) wrdn.ImageRef {
+	imageRef := wrdn.ImageRef{URI: uri}
+
+	if !strings.HasPrefix(uri, "docker://") {
+		return imageRef
 	}
 
-	// Do not Wait() for the process to finish
-	_, err := container.Run(processSpec, wrdn.ProcessIO{})
-	if err != nil {
-		return bosherr.WrapError(err, "Preparing Container")
+	// Garden also accepts docker:/// URIs without registry host
+	reference := strings.TrimPrefix(strings.TrimPrefix(uri, "docker://"), "/")
+
+	if creds, found := bwcstem.FindRegistryCredentials(c.Config.Actions.RegistryCredentials, reference); found {
+		imageRef.Username = creds.Username
+		imageRef.Password = creds.Password
 	}
 
-	return nil
+	return imageRef
 }
 
 func (c WardenCreator) cleanUpContainer(container wrdn.Container) {
@@ -267,3 +336,20 @@ func (c WardenCreator) cleanUpContainer(container wrdn.Container) {
 		c.logger.Error("WardenCreator", "Failed destroying container '%s': %s", container.Handle(), err.Error())
 	}
 }
+
+// createContainer keeps stemcell image from being deleted until
+// container recording that it uses the image exists
+func (c WardenCreator) createContainer(stemcell bwcstem.Stemcell, spec wrdn.ContainerSpec) (wrdn.Container, error) {
+	unlock, err := stemcell.LockImage()
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Locking stemcell '%s'", stemcell.ID())
+	}
+	defer unlock()
+
+	container, err := c.wardenClient.Create(spec)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating container")
+	}
+
+	return container, nil
+}
@@ -1,12 +1,16 @@
 package vm_test
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	wrdn "code.cloudfoundry.org/garden"
 	wrdnclient "code.cloudfoundry.org/garden/client"
 	fakewrdnconn "code.cloudfoundry.org/garden/client/connection/connectionfakes"
+	"code.cloudfoundry.org/garden/gardenfakes"
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	fakeuuid "github.com/cloudfoundry/bosh-utils/uuid/fakes"
@@ -14,7 +18,9 @@ import (
 	. "github.com/onsi/gomega"
 
 	"bosh-warden-cpi/config"
+	bwcstem "bosh-warden-cpi/stemcell"
 	fakestem "bosh-warden-cpi/stemcell/fakes"
+	bwcutil "bosh-warden-cpi/util"
 	. "bosh-warden-cpi/vm"
 	fakevm "bosh-warden-cpi/vm/fakes"
 )
@@ -35,9 +41,10 @@ var _ = Describe("WardenCreator", func() {
 		systemResolvConfProviderErr  error
 		agentOptions                 apiv1.AgentOptions
 
-		logger  boshlog.Logger
-		creator WardenCreator
-		config  config.Config
+		clock     *bwcutil.FakeClock
+		logger    boshlog.Logger
+		creator   WardenCreator
+		cpiConfig config.Config
 	)
 
 	BeforeEach(func() {
@@ -61,11 +68,12 @@ var _ = Describe("WardenCreator", func() {
 		resolvProvider := func() (ResolvConf, error) {
 			return systemResolvConfProviderConf, systemResolvConfProviderErr
 		}
+		clock = bwcutil.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
 		logger = boshlog.NewLogger(boshlog.LevelNone)
 
 		creator = NewWardenCreator(
 			uuidGen, wardenClient, fakeMetadataService, agentEnvServiceFactory,
-			ports, hostBindMounts, guestBindMounts, resolvProvider, agentOptions, logger, config)
+			ports, hostBindMounts, guestBindMounts, resolvProvider, clock, agentOptions, logger, cpiConfig)
 	})
 
 	Describe("Create", func() {
@@ -166,6 +174,77 @@ var _ = Describe("WardenCreator", func() {
 				Expect(containerSpec.Image.URI).To(Equal("/fake-stemcell-path"))
 			})
 
+			It("creates container with registry credentials for light stemcell image", func() {
+				stemcell = fakestem.NewFakeStemcellWithPath(
+					apiv1.NewStemcellCID("fake-stemcell-id"),
+					"docker://registry.example.com:5000/org/image:1.2",
+				)
+
+				creator.Config.Actions.RegistryCredentials = map[string]config.RegistryCredentials{
+					"registry.example.com:5000": {Username: "fake-user", Password: "fake-password"},
+					"other.example.com":         {Username: "other-user", Password: "other-password"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Image).To(Equal(wrdn.ImageRef{
+					URI:      "docker://registry.example.com:5000/org/image:1.2",
+					Username: "fake-user",
+					Password: "fake-password",
+				}))
+			})
+
+			It("creates container with Docker Hub credentials for unqualified image", func() {
+				stemcell = fakestem.NewFakeStemcellWithPath(apiv1.NewStemcellCID("fake-stemcell-id"), "docker://ubuntu:jammy")
+
+				creator.Config.Actions.RegistryCredentials = map[string]config.RegistryCredentials{
+					"docker.io": {Username: "fake-user", Password: "fake-password"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Image.Username).To(Equal("fake-user"))
+				Expect(containerSpec.Image.Password).To(Equal("fake-password"))
+			})
+
+			It("creates container with Docker Hub API host credentials for digest-pinned unqualified image", func() {
+				stemcell = fakestem.NewFakeStemcellWithPath(
+					apiv1.NewStemcellCID("fake-stemcell-id"),
+					"docker://ubuntu@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				)
+
+				creator.Config.Actions.RegistryCredentials = map[string]config.RegistryCredentials{
+					"registry-1.docker.io": {Username: "fake-user", Password: "fake-password"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Image.Username).To(Equal("fake-user"))
+			})
+
+			It("creates container without credentials for registries that are not configured", func() {
+				stemcell = fakestem.NewFakeStemcellWithPath(
+					apiv1.NewStemcellCID("fake-stemcell-id"),
+					"docker://ghcr.io/org/image:1.2",
+				)
+
+				creator.Config.Actions.RegistryCredentials = map[string]config.RegistryCredentials{
+					"registry.example.com:5000": {Username: "fake-user", Password: "fake-password"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Image).To(Equal(wrdn.ImageRef{URI: "docker://ghcr.io/org/image:1.2"}))
+			})
+
 			It("creates container with bind mounted ephemeral disk and persistent root location", func() {
 				hostBindMounts.MakeEphemeralPath = "/fake-host-ephemeral-bind-mount-path"
 				hostBindMounts.MakePersistentPath = "/fake-host-persistent-bind-mounts-dir"
@@ -211,6 +290,87 @@ var _ = Describe("WardenCreator", func() {
 				))
 			})
 
+			It("starts containers of stemcells that predate systemd with Garden's init when systemd is enabled", func() {
+				creator.Config.StartContainersWithSystemD = true
+				stemcell.MetadataResult = &bwcstem.Metadata{OperatingSystem: "ubuntu-jammy"}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Env).To(Equal([]string{"BOSH_INIT_SYSTEM=runit"}))
+				Expect(containerSpec.BindMounts).To(ContainElement(
+					wrdn.BindMount{
+						SrcPath: "/var/vcap/data/garden/bin/init",
+						DstPath: "/tmp/garden-default-init",
+						Mode:    wrdn.BindMountModeRO,
+						Origin:  wrdn.BindMountOriginHost,
+					},
+				))
+				Expect(containerSpec.BindMounts).ToNot(ContainElement(
+					HaveField("DstPath", "/sys/fs/cgroup"),
+				))
+			})
+
+			It("starts containers with systemd if stemcell metadata specifies it", func() {
+				creator.Config.StartContainersWithSystemD = true
+				stemcell.MetadataResult = &bwcstem.Metadata{
+					OperatingSystem: "ubuntu-jammy",
+					CloudProperties: bwcstem.CloudProperties{InitSystem: "systemd"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Env).To(Equal([]string{"BOSH_INIT_SYSTEM=systemd"}))
+				Expect(containerSpec.BindMounts).To(ContainElement(
+					HaveField("DstPath", "/sys/fs/cgroup"),
+				))
+			})
+
+			It("starts containers with init system from VM cloud properties regardless of stemcell", func() {
+				creator.Config.StartContainersWithSystemD = true
+				stemcell.MetadataResult = &bwcstem.Metadata{OperatingSystem: "ubuntu-noble"}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{InitSystem: InitSystemRunit}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Env).To(Equal([]string{"BOSH_INIT_SYSTEM=runit"}))
+			})
+
+			It("does not bind mount cgroups or set init system when systemd is disabled", func() {
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				containerSpec := wardenConn.CreateArgsForCall(0)
+				Expect(containerSpec.Env).To(BeEmpty())
+				Expect(containerSpec.BindMounts).To(HaveLen(2))
+			})
+
+			It("returns error without creating container if stemcell requires systemd but systemd is disabled", func() {
+				stemcell.MetadataResult = &bwcstem.Metadata{
+					CloudProperties: bwcstem.CloudProperties{InitSystem: "systemd"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("requires warden_cpi.start_containers_with_systemd to be enabled"))
+
+				Expect(wardenConn.CreateCallCount()).To(Equal(0))
+			})
+
+			It("returns error if stemcell metadata has unknown init system", func() {
+				stemcell.MetadataResult = &bwcstem.Metadata{
+					CloudProperties: bwcstem.CloudProperties{InitSystem: "upstart"},
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Expected init system to be 'runit' or 'systemd' but was 'upstart'"))
+			})
+
 			It("returns error if making host ephemeral bind mount fails", func() {
 				hostBindMounts.MakeEphemeralErr = errors.New("fake-make-ephemeral-err")
 
@@ -254,12 +414,37 @@ var _ = Describe("WardenCreator", func() {
 				Expect(containerSpec.Network).To(BeEmpty()) // fake-ip is not used
 			})
 
-			It("creates container without properties", func() {
+			It("creates container with stemcell id and image properties", func() {
 				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
 				Expect(err).ToNot(HaveOccurred())
 
 				containerSpec := wardenConn.CreateArgsForCall(0)
-				Expect(containerSpec.Properties).To(Equal(wrdn.Properties{}))
+				Expect(containerSpec.Properties).To(Equal(wrdn.Properties{
+					"bosh.stemcell_cid":   "fake-stemcell-id",
+					"bosh.stemcell_image": "/fake-stemcell-path",
+				}))
+			})
+
+			It("creates container while holding stemcell image lock", func() {
+				wardenConn.CreateStub = func(wrdn.ContainerSpec) (string, error) {
+					Expect(stemcell.LockImageHeld).To(BeTrue())
+					return "fake-vm-id", nil
+				}
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(stemcell.LockImageCalled).To(BeTrue())
+				Expect(stemcell.LockImageHeld).To(BeFalse())
+			})
+
+			It("returns error if locking stemcell image fails", func() {
+				stemcell.LockImageErr = errors.New("fake-lock-err")
+
+				_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-lock-err"))
+				Expect(wardenConn.CreateCallCount()).To(Equal(0))
 			})
 
 			Context("when creating container succeeds", func() {
@@ -350,7 +535,8 @@ var _ = Describe("WardenCreator", func() {
 						handle, processSpec, processIO := wardenConn.RunArgsForCall(0)
 						Expect(handle).To(Equal("fake-vm-id"))
 						Expect(processSpec).To(Equal(expectedProcessSpec))
-						Expect(processIO).To(Equal(wrdn.ProcessIO{}))
+						Expect(processIO.Stdout).ToNot(BeNil())
+						Expect(processIO.Stderr).ToNot(BeNil())
 					})
 
 					It("does not start the bosh agent when starting container with systemd", func() {
@@ -373,7 +559,254 @@ var _ = Describe("WardenCreator", func() {
 						handle, processSpec, processIO := wardenConn.RunArgsForCall(0)
 						Expect(handle).To(Equal("fake-vm-id"))
 						Expect(processSpec).To(Equal(expectedProcessSpec))
-						Expect(processIO).To(Equal(wrdn.ProcessIO{}))
+						Expect(processIO.Stdout).ToNot(BeNil())
+						Expect(processIO.Stderr).ToNot(BeNil())
+					})
+
+					It("runs bootstrap script configured for stemcell operating system and init system", func() {
+						creator.Config.Actions.BootstrapScripts = map[string]string{
+							"ubuntu-jammy/runit": "echo {{.VMCID}} {{.AgentID}} {{.StemcellCID}} {{.StemcellVersion}} {{.InitSystem}}",
+						}
+						stemcell.MetadataResult = &bwcstem.Metadata{OperatingSystem: "ubuntu-jammy", Version: "1.2"}
+
+						_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+						Expect(err).ToNot(HaveOccurred())
+
+						_, processSpec, _ := wardenConn.RunArgsForCall(0)
+						Expect(processSpec.Path).To(Equal("/bin/bash"))
+						Expect(processSpec.Args).To(Equal([]string{
+							"-c", "echo fake-vm-id fake-agent-id fake-stemcell-id 1.2 runit",
+						}))
+					})
+
+					It("runs default bootstrap script for operating systems without configured script", func() {
+						creator.Config.Actions.BootstrapScripts = map[string]string{"ubuntu-noble/systemd": "echo noble"}
+						stemcell.MetadataResult = &bwcstem.Metadata{OperatingSystem: "ubuntu-jammy"}
+
+						_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+						Expect(err).ToNot(HaveOccurred())
+
+						_, processSpec, _ := wardenConn.RunArgsForCall(0)
+						Expect(processSpec.Args[1]).To(HaveSuffix("exec env -i /usr/sbin/runsvdir-start"))
+					})
+
+					It("runs default bootstrap script if init system is overridden for VM", func() {
+						creator.Config.StartContainersWithSystemD = true
+						creator.Config.Actions.BootstrapScripts = map[string]string{"ubuntu-jammy/runit": "echo runit"}
+						stemcell.MetadataResult = &bwcstem.Metadata{OperatingSystem: "ubuntu-jammy"}
+
+						_, err := creator.Create(
+							apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{InitSystem: InitSystemSystemD}, networks, env)
+						Expect(err).ToNot(HaveOccurred())
+
+						_, processSpec, _ := wardenConn.RunArgsForCall(0)
+						Expect(processSpec.Args[1]).To(Equal("umount /etc/hosts"))
+					})
+
+					It("logs output of bootstrap script", func() {
+						logBuffer := &bytes.Buffer{}
+						creator = NewWardenCreator(
+							uuidGen, wardenClient, fakeMetadataService, agentEnvServiceFactory, ports, hostBindMounts,
+							guestBindMounts, func() (ResolvConf, error) { return ResolvConf{}, nil }, clock, agentOptions,
+							boshlog.NewWriterLogger(boshlog.LevelDebug, logBuffer), cpiConfig)
+
+						wardenConn.RunStub = func(_ string, _ wrdn.ProcessSpec, processIO wrdn.ProcessIO) (wrdn.Process, error) {
+							fmt.Fprint(processIO.Stderr, "umount: /etc/hosts: not mounted\n") //nolint:errcheck
+							return nil, nil
+						}
+
+						_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(logBuffer.String()).To(ContainSubstring(
+							"Bootstrap script of VM 'fake-vm-id' stderr: umount: /etc/hosts: not mounted"))
+					})
+
+					It("returns error if configured bootstrap script cannot be rendered", func() {
+						creator.Config.Actions.BootstrapScripts = map[string]string{"ubuntu-jammy/runit": "echo {{.Unknown}}"}
+						stemcell.MetadataResult = &bwcstem.Metadata{OperatingSystem: "ubuntu-jammy"}
+
+						_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("Rendering bootstrap script for 'ubuntu-jammy/runit'"))
+
+						Expect(wardenConn.RunCallCount()).To(Equal(0))
+						Expect(wardenConn.StopCallCount()).To(Equal(1))
+					})
+
+					Context("when waiting for BOSH Agent to start", func() {
+						var (
+							bootstrapStderr  string
+							bootstrapExit    chan int
+							agentStatuses    []string
+							agentUnitStates  []string
+							agentCheckLength time.Duration
+						)
+
+						exitedProcess := func(status int, delay time.Duration) *gardenfakes.FakeProcess {
+							process := &gardenfakes.FakeProcess{}
+							process.WaitStub = func() (int, error) {
+								time.Sleep(delay)
+								clock.Advance(agentCheckLength)
+								return status, nil
+							}
+							return process
+						}
+
+						BeforeEach(func() {
+							creator.Config.Actions.AgentReadinessTimeout = 5
+
+							bootstrapStderr = ""
+							bootstrapExit = make(chan int, 1)
+							agentStatuses = nil
+							agentUnitStates = nil
+							agentCheckLength = 0
+
+							wardenConn.RunStub = func(_ string, spec wrdn.ProcessSpec, processIO wrdn.ProcessIO) (wrdn.Process, error) {
+								switch spec.Args[1] {
+								case "sv status agent":
+									status := "down: agent: 1s, normally up; run: log: (pid 10) 1s"
+									if len(agentStatuses) > 0 {
+										status, agentStatuses = agentStatuses[0], agentStatuses[1:]
+									}
+									fmt.Fprintln(processIO.Stdout, status) //nolint:errcheck
+									return exitedProcess(0, 10*time.Millisecond), nil
+
+								case "tail -n 50 /var/vcap/bosh/log/current":
+									fmt.Fprintln(processIO.Stdout, "fake-agent-log") //nolint:errcheck
+									return exitedProcess(0, 0), nil
+
+								case "systemctl is-active bosh-agent":
+									state := "activating"
+									if len(agentUnitStates) > 0 {
+										state, agentUnitStates = agentUnitStates[0], agentUnitStates[1:]
+									}
+									fmt.Fprintln(processIO.Stdout, state) //nolint:errcheck
+									return exitedProcess(0, 10*time.Millisecond), nil
+
+								case "journalctl --unit bosh-agent --lines 50 --no-pager":
+									fmt.Fprintln(processIO.Stdout, "fake-agent-journal") //nolint:errcheck
+									return exitedProcess(0, 0), nil
+
+								default:
+									fmt.Fprint(processIO.Stderr, bootstrapStderr) //nolint:errcheck
+									exit := bootstrapExit
+									process := &gardenfakes.FakeProcess{}
+									process.WaitStub = func() (int, error) { return <-exit, nil }
+									return process, nil
+								}
+							}
+						})
+
+						AfterEach(func() {
+							close(bootstrapExit)
+						})
+
+						It("waits until BOSH Agent keeps running in container", func() {
+							agentStatuses = []string{
+								"run: agent: (pid 12) 0s; run: log: (pid 10) 1s",
+								"run: agent: (pid 12) 1s; run: log: (pid 10) 2s",
+								"run: agent: (pid 12) 3s; run: log: (pid 10) 4s",
+							}
+
+							_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+							Expect(err).ToNot(HaveOccurred())
+
+							Expect(wardenConn.RunCallCount()).To(Equal(4))
+							Expect(clock.SleptTimes()).To(Equal([]time.Duration{time.Second, time.Second}))
+						})
+
+						It("returns error with agent log and destroys container if BOSH Agent keeps restarting", func() {
+							bootstrapStderr = "fake-bootstrap-stderr\n"
+
+							for i := 0; i < 10; i++ {
+								agentStatuses = append(agentStatuses, "run: agent: (pid 12) 0s; run: log: (pid 10) 1s")
+							}
+
+							_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("BOSH Agent did not start within 5s; " +
+								"bootstrap script stderr: fake-bootstrap-stderr; agent log: fake-agent-log"))
+
+							Expect(clock.SleptTimes()).To(HaveLen(5))
+							Expect(wardenConn.StopCallCount()).To(Equal(1))
+						})
+
+						It("counts time spent checking BOSH Agent towards timeout", func() {
+							agentCheckLength = 2 * time.Second
+
+							_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("BOSH Agent did not start within 5s"))
+
+							Expect(clock.SleptTimes()).To(HaveLen(1))
+						})
+
+						It("returns error right away if bootstrap script fails", func() {
+							creator.Config.Actions.AgentReadinessTimeout = 600
+							bootstrapStderr = "runsvdir-start: not found\n"
+							bootstrapExit <- 127
+
+							_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("Bootstrap script exited with status 127 before BOSH Agent started; " +
+								"stderr: runsvdir-start: not found; agent log: fake-agent-log"))
+
+							Expect(len(clock.SleptTimes())).To(BeNumerically("<", 599))
+							Expect(wardenConn.StopCallCount()).To(Equal(1))
+						})
+
+						It("keeps waiting if bootstrap script exits successfully", func() {
+							bootstrapExit <- 0
+							agentStatuses = []string{
+								"down: agent: 1s, normally up; run: log: (pid 10) 1s",
+								"down: agent: 1s, normally up; run: log: (pid 10) 1s",
+								"run: agent: (pid 12) 5s; run: log: (pid 10) 6s",
+							}
+
+							_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+							Expect(err).ToNot(HaveOccurred())
+
+							Expect(clock.SleptTimes()).To(HaveLen(2))
+						})
+
+						Context("when starting container with systemd", func() {
+							BeforeEach(func() {
+								creator.Config.StartContainersWithSystemD = true
+							})
+
+							It("waits until BOSH Agent unit is active", func() {
+								bootstrapExit <- 0
+								agentUnitStates = []string{"activating", "active"}
+
+								_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+								Expect(err).ToNot(HaveOccurred())
+
+								Expect(clock.SleptTimes()).To(HaveLen(1))
+							})
+
+							It("keeps waiting if preparing container fails", func() {
+								bootstrapStderr = "umount: /etc/hosts: not mounted\n"
+								bootstrapExit <- 32
+								agentUnitStates = []string{"activating", "activating", "active"}
+
+								_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+								Expect(err).ToNot(HaveOccurred())
+
+								Expect(clock.SleptTimes()).To(HaveLen(2))
+							})
+
+							It("returns error with unit journal if BOSH Agent unit fails", func() {
+								bootstrapExit <- 0
+								agentUnitStates = []string{"activating", "failed"}
+
+								_, err := creator.Create(apiv1.NewAgentID("fake-agent-id"), stemcell, VMProps{}, networks, env)
+								Expect(err).To(HaveOccurred())
+								Expect(err.Error()).To(ContainSubstring("BOSH Agent unit failed; journal: fake-agent-journal"))
+
+								Expect(wardenConn.StopCallCount()).To(Equal(1))
+							})
+						})
 					})
 
 					Context("when BOSH Agent fails to start", func() {
@@ -1,10 +1,13 @@
 package vm
 
 import (
+	wrdn "code.cloudfoundry.org/garden"
 	wrdnclient "code.cloudfoundry.org/garden/client"
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+
+	bwcstem "bosh-warden-cpi/stemcell"
 )
 
 type WardenFinder struct {
@@ -68,3 +71,33 @@ func (f WardenFinder) Find(id apiv1.VMCID) (VM, bool, error) {
 
 	return vm, false, nil
 }
+
+func (f WardenFinder) FindByStemcell(stemcell bwcstem.Stemcell) ([]apiv1.VMCID, error) {
+	f.logger.Debug(f.logTag, "Finding containers created from stemcell '%s'", stemcell.ID())
+
+	// Containers created before images were recorded only have stemcell CID
+	filters := []wrdn.Properties{
+		{StemcellCIDProperty: stemcell.ID().AsString()},
+		{StemcellImageProperty: stemcell.URI()},
+	}
+
+	var ids []apiv1.VMCID
+
+	seen := map[string]bool{}
+
+	for _, filter := range filters {
+		containers, err := f.wardenClient.Containers(filter)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Listing containers created from stemcell '%s'", stemcell.ID())
+		}
+
+		for _, container := range containers {
+			if !seen[container.Handle()] {
+				seen[container.Handle()] = true
+				ids = append(ids, apiv1.NewVMCID(container.Handle()))
+			}
+		}
+	}
+
+	return ids, nil
+}
@@ -3,6 +3,7 @@ package vm_test
 import (
 	"errors"
 
+	wrdn "code.cloudfoundry.org/garden"
 	wrdnclient "code.cloudfoundry.org/garden/client"
 	fakewrdnconn "code.cloudfoundry.org/garden/client/connection/connectionfakes"
 	"github.com/cloudfoundry/bosh-cpi-go/apiv1"
@@ -10,6 +11,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	fakestem "bosh-warden-cpi/stemcell/fakes"
 	. "bosh-warden-cpi/vm"
 	fakevm "bosh-warden-cpi/vm/fakes"
 )
@@ -84,4 +86,49 @@ var _ = Describe("WardenFinder", func() {
 			Expect(vm).To(BeNil())
 		})
 	})
+
+	Describe("FindByStemcell", func() {
+		var stemcell *fakestem.FakeStemcell
+
+		BeforeEach(func() {
+			stemcell = fakestem.NewFakeStemcellWithPath(
+				apiv1.NewStemcellCID("fake-stemcell-id"), "/fake-stemcells-dir/fake-checksum/image")
+		})
+
+		It("returns IDs of containers created from stemcell or from image it shares", func() {
+			wardenConn.ListReturnsOnCall(0, []string{"fake-vm-id-1", "fake-vm-id-2"}, nil)
+			wardenConn.ListReturnsOnCall(1, []string{"fake-vm-id-2", "fake-vm-id-3"}, nil)
+
+			ids, err := finder.FindByStemcell(stemcell)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(Equal([]apiv1.VMCID{
+				apiv1.NewVMCID("fake-vm-id-1"),
+				apiv1.NewVMCID("fake-vm-id-2"),
+				apiv1.NewVMCID("fake-vm-id-3"),
+			}))
+
+			Expect(wardenConn.ListArgsForCall(0)).To(Equal(wrdn.Properties{
+				"bosh.stemcell_cid": "fake-stemcell-id",
+			}))
+			Expect(wardenConn.ListArgsForCall(1)).To(Equal(wrdn.Properties{
+				"bosh.stemcell_image": "/fake-stemcells-dir/fake-checksum/image",
+			}))
+		})
+
+		It("returns no IDs if no containers were created from stemcell", func() {
+			wardenConn.ListReturns(nil, nil)
+
+			ids, err := finder.FindByStemcell(stemcell)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ids).To(BeEmpty())
+		})
+
+		It("returns error if warden container listing fails", func() {
+			wardenConn.ListReturns(nil, errors.New("fake-list-err"))
+
+			_, err := finder.FindByStemcell(stemcell)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-list-err"))
+		})
+	})
 })
@@ -87,12 +87,12 @@ func (vm WardenVM) AttachDisk(disk bwcdisk.Disk) (apiv1.DiskHint, error) {
 		return apiv1.DiskHint{}, bosherr.WrapError(err, "Fetching agent env")
 	}
 
-	err = vm.hostBindMounts.MountPersistent(vm.id, disk.ID(), disk.Path())
+	err = vm.hostBindMounts.MountPersistent(vm.id, disk)
 	if err != nil {
 		return apiv1.DiskHint{}, bosherr.WrapError(err, "Mounting persistent bind mounts dir")
 	}
 
-	diskHint := apiv1.NewDiskHintFromString(vm.guestBindMounts.MountPersistent(disk.ID()))
+	diskHint := vm.guestBindMounts.PersistentDiskHint(disk.ID())
 
 	agentEnv.AttachPersistentDisk(disk.ID(), diskHint)
 
@@ -114,7 +114,7 @@ func (vm WardenVM) DetachDisk(disk bwcdisk.Disk) error {
 		return bosherr.WrapError(err, "Fetching agent env")
 	}
 
-	err = vm.hostBindMounts.UnmountPersistent(vm.id, disk.ID())
+	err = vm.hostBindMounts.UnmountPersistent(vm.id, disk)
 	if err != nil {
 		return bosherr.WrapError(err, "Unmounting persistent bind mounts dir")
 	}